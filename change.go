@@ -0,0 +1,80 @@
+package scimpatch
+
+import (
+	"reflect"
+)
+
+// Kind of a change made to a resource
+type ChangeKind string
+
+const (
+	ValueAssigned   = ChangeKind("valueAssigned")   // a single-valued attribute was assigned
+	ValueRemoved    = ChangeKind("valueRemoved")    // a single-valued attribute was removed
+	ElementAdded    = ChangeKind("elementAdded")    // an element was added to a multi-valued attribute
+	ElementRemoved  = ChangeKind("elementRemoved")  // an element was removed from a multi-valued attribute
+	ElementReplaced = ChangeKind("elementReplaced") // an element of a multi-valued attribute was replaced
+)
+
+// A change made to a resource by a patch operation
+type Change struct {
+	Op        string      `json:"op"`        // operation that made the change, one of [add|remove|replace]
+	Kind      ChangeKind  `json:"kind"`      // what happened to the attribute
+	Path      string      `json:"path"`      // case corrected path of the patch operation
+	Attribute string      `json:"attribute"` // full path of the changed attribute, see Assist.FullPath
+	OldValue  interface{} `json:"oldValue"`  // value or element before the change, nil if it was not assigned
+	NewValue  interface{} `json:"newValue"`  // value or element after the change, nil if it was removed
+}
+
+// Receiver of the changes made by the patch engine
+type ChangeObserver interface {
+	ObserveChange(c Change)
+}
+
+// Adapter to use an ordinary function as a ChangeObserver
+type ChangeObserverFunc func(c Change)
+
+func (f ChangeObserverFunc) ObserveChange(c Change) {
+	f(c)
+}
+
+// Observer which holds the changes until they are flushed to another observer
+type changeBuffer struct {
+	changes []Change
+}
+
+func (b *changeBuffer) ObserveChange(c Change) {
+	b.changes = append(b.changes, c)
+}
+
+func (b *changeBuffer) flush(observer ChangeObserver) {
+	if observer != nil {
+		for _, c := range b.changes {
+			observer.ObserveChange(c)
+		}
+	}
+	b.changes = nil
+}
+
+// Preview the patch without touching the resource.
+// The patch is applied to a copy of the resource, which is returned along with the changes made to it.
+func DryRunPatch(patch Patch, subj *Resource, schema *Schema, opts ...PatchOption) (*Resource, []Change, error) {
+	return DryRunModification(Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{patch}}, subj, schema, opts...)
+}
+
+// Preview all operations of the modification without touching the resource.
+// The operations are applied in order to a copy of the resource as ApplyModification does, including the check of the
+// required attributes, and the copy is returned along with the changes made to it.
+func DryRunModification(mod Modification, subj *Resource, schema *Schema, opts ...PatchOption) (*Resource, []Change, error) {
+	working, buffer, err := modify(mod, subj, schema, newPatchOptions(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	return working, buffer.changes, nil
+}
+
+func copyOfValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return deepCopy(v.Interface())
+}
@@ -0,0 +1,204 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestDryRunPatch(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		patch     Patch
+		assertion func(r *Resource, changes []Change, err error)
+	}{
+		{
+			"replace simple path",
+			Patch{Op: Replace, Path: "UserName", Value: "foo"},
+			func(r *Resource, changes []Change, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", r.GetData()["userName"])
+				require.Equal(t, 1, len(changes))
+				assert.Equal(t, Change{
+					Op:        Replace,
+					Kind:      ValueAssigned,
+					Path:      "userName",
+					Attribute: "urn:ietf:params:scim:schemas:core:2.0:User:userName",
+					OldValue:  "david@example.com",
+					NewValue:  "foo",
+				}, changes[0])
+			},
+		},
+		{
+			"add implicit path",
+			Patch{Op: Add, Value: map[string]interface{}{"nickName": "Q"}},
+			func(r *Resource, changes []Change, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "Q", r.GetData()["nickName"])
+				require.Equal(t, 1, len(changes))
+				assert.Equal(t, Change{
+					Op:        Add,
+					Kind:      ValueAssigned,
+					Path:      "nickName",
+					Attribute: "urn:ietf:params:scim:schemas:core:2.0:User:nickName",
+					OldValue:  nil,
+					NewValue:  "Q",
+				}, changes[0])
+			},
+		},
+		{
+			"remove multivalued with filter",
+			Patch{Op: Remove, Path: "emails[type eq \"work\"]"},
+			func(r *Resource, changes []Change, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 1, len(r.GetData()["emails"].([]interface{})))
+				require.Equal(t, 1, len(changes))
+				assert.Equal(t, Remove, changes[0].Op)
+				assert.Equal(t, ElementRemoved, changes[0].Kind)
+				assert.Equal(t, "work", changes[0].OldValue.(map[string]interface{})["type"])
+				assert.Nil(t, changes[0].NewValue)
+			},
+		},
+		{
+			"remove absent attribute",
+			Patch{Op: Remove, Path: "nickName"},
+			func(r *Resource, changes []Change, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 0, len(changes))
+			},
+		},
+		{
+			"invalid path",
+			Patch{Op: Add, Path: "dummy", Value: "foo"},
+			func(r *Resource, changes []Change, err error) {
+				assert.NotNil(t, err)
+				assert.Nil(t, r)
+			},
+		},
+	} {
+		const TestUserJson = `
+			{
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+				"id": "6B69753B-4E38-444E-8AC6-9D0E4D644D80",
+				"userName": "david@example.com",
+				"emails": [
+					{
+						"value": "david@example.com",
+						"type": "work"
+					},
+					{
+						"value": "david@home.com",
+						"type": "home"
+					}
+				]
+			}
+		`
+
+		t.Run(test.name, func(t *testing.T) {
+			data := make(map[string]interface{}, 0)
+			err := json.Unmarshal([]byte(TestUserJson), &data)
+			assert.Nil(t, err)
+
+			resource := &Resource{Complex(data)}
+			orig := resource.Complex.Clone()
+			r, changes, err := DryRunPatch(test.patch, resource, schema)
+			test.assertion(r, changes, err)
+			assert.True(t, reflect.DeepEqual(orig, resource.Complex))
+		})
+	}
+}
+
+func TestChangeObserver(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(GroupSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		mod       Modification
+		assertion func(changes []Change, err error)
+	}{
+		{
+			"add members",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Add, Path: "members", Value: []interface{}{
+					map[string]interface{}{"value": "added_member_id"},
+				}},
+			}},
+			func(changes []Change, err error) {
+				assert.Nil(t, err)
+				require.Equal(t, 1, len(changes))
+				assert.Equal(t, ElementAdded, changes[0].Kind)
+				assert.Equal(t, "urn:ietf:params:scim:schemas:core:2.0:Group:members", changes[0].Attribute)
+				assert.Nil(t, changes[0].OldValue)
+				assert.Equal(t, map[string]interface{}{"value": "added_member_id"}, changes[0].NewValue)
+			},
+		},
+		{
+			"remove all members",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Remove, Path: "members"},
+			}},
+			func(changes []Change, err error) {
+				assert.Nil(t, err)
+				require.Equal(t, 2, len(changes))
+				for _, c := range changes {
+					assert.Equal(t, Remove, c.Op)
+					assert.Equal(t, ElementRemoved, c.Kind)
+				}
+				assert.Equal(t, map[string]interface{}{"value": "member_a"}, changes[0].OldValue)
+				assert.Equal(t, map[string]interface{}{"value": "member_b"}, changes[1].OldValue)
+			},
+		},
+		{
+			"remove a member and rename",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Remove, Path: "members[value eq \"member_b\"]"},
+				{Op: Replace, Path: "displayName", Value: "Tour Leaders"},
+			}},
+			func(changes []Change, err error) {
+				assert.Nil(t, err)
+				require.Equal(t, 2, len(changes))
+				assert.Equal(t, ElementRemoved, changes[0].Kind)
+				assert.Equal(t, map[string]interface{}{"value": "member_b"}, changes[0].OldValue)
+				assert.Equal(t, ValueAssigned, changes[1].Kind)
+				assert.Equal(t, "Tour Guides", changes[1].OldValue)
+				assert.Equal(t, "Tour Leaders", changes[1].NewValue)
+			},
+		},
+		{
+			"nothing is reported when a modification fails",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Replace, Path: "displayName", Value: "Tour Leaders"},
+				{Op: Add, Path: "dummy", Value: "foo"},
+			}},
+			func(changes []Change, err error) {
+				assert.NotNil(t, err)
+				assert.Equal(t, 0, len(changes))
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{
+				"displayName": "Tour Guides",
+				"members": []interface{}{
+					map[string]interface{}{"value": "member_a"},
+					map[string]interface{}{"value": "member_b"},
+				},
+			}}
+
+			changes := make([]Change, 0)
+			observer := ChangeObserverFunc(func(c Change) {
+				changes = append(changes, c)
+			})
+			err := ApplyModification(test.mod, resource, schema, WithObserver(observer))
+			test.assertion(changes, err)
+		})
+	}
+}
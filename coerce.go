@@ -0,0 +1,177 @@
+package scimpatch
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Check the value against the type of the attribute and convert it to its canonical representation:
+// integers become int64, decimals become float64, and complex values are checked down to their sub attributes.
+// Integral JSON numbers (float64) are accepted as integers as long as the conversion is lossless.
+// Sub attributes not defined by the schema are left as they are, and nil is always accepted as an unassigned value.
+func (a *Attribute) Coerce(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if !a.MultiValued {
+		return a.coerceSingle(value)
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		elemAttr := a.elementAttribute()
+		arr := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, err := elemAttr.coerceSingle(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, elem)
+		}
+		return arr, nil
+	default:
+		return nil, a.invalidValue(value)
+	}
+}
+
+// Same as Coerce, but a multi-valued attribute also accepts a single element, which is checked against the element type.
+func (a *Attribute) CoerceElement(value interface{}) (interface{}, error) {
+	if a.MultiValued {
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Array, reflect.Slice:
+		default:
+			return a.elementAttribute().coerceSingle(value)
+		}
+	}
+	return a.Coerce(value)
+}
+
+// copy of the attribute describing a single element of the multi-valued attribute
+func (a *Attribute) elementAttribute() *Attribute {
+	elemAttr := a.Clone()
+	elemAttr.MultiValued = false
+	return elemAttr
+}
+
+func (a *Attribute) coerceSingle(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch {
+	case a.ExpectsBinary():
+		if s, ok := value.(string); ok {
+			if _, err := base64.StdEncoding.DecodeString(s); err == nil {
+				return s, nil
+			}
+		}
+
+	case a.ExpectsString():
+		if s, ok := value.(string); ok {
+			if a.Type != TypeDateTime {
+				return s, nil
+			}
+			if _, err := time.Parse(time.RFC3339, s); err == nil {
+				return s, nil
+			}
+		}
+
+	case a.ExpectsBool():
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+
+	case a.ExpectsInteger():
+		switch n := value.(type) {
+		case int:
+			return int64(n), nil
+		case int8:
+			return int64(n), nil
+		case int16:
+			return int64(n), nil
+		case int32:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		case float32:
+			if i, ok := integral(float64(n)); ok {
+				return i, nil
+			}
+		case float64:
+			if i, ok := integral(n); ok {
+				return i, nil
+			}
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		}
+
+	case a.ExpectsFloat():
+		switch n := value.(type) {
+		case int:
+			return float64(n), nil
+		case int8:
+			return float64(n), nil
+		case int16:
+			return float64(n), nil
+		case int32:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case float32:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		case json.Number:
+			if f, err := n.Float64(); err == nil {
+				return f, nil
+			}
+		}
+
+	case a.ExpectsComplex():
+		var m map[string]interface{}
+		switch c := value.(type) {
+		case map[string]interface{}:
+			m = c
+		case Complex:
+			m = c
+		default:
+			return nil, a.invalidValue(value)
+		}
+
+		coerced := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			subAttr := a.SubAttribute(k)
+			if subAttr == nil {
+				coerced[k] = v
+				continue
+			}
+			v0, err := subAttr.Coerce(v)
+			if err != nil {
+				return nil, err
+			}
+			coerced[k] = v0
+		}
+		return coerced, nil
+	}
+
+	return nil, a.invalidValue(value)
+}
+
+func (a *Attribute) invalidValue(value interface{}) *Error {
+	return errInvalidValue("Invalid value for attribute %s: expected %s but got %v", a.Assist.FullPath, a.TypeExpectation(), value)
+}
+
+// convert the float to int64 if no information is lost
+func integral(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
@@ -0,0 +1,108 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAttribute_Coerce(t *testing.T) {
+	attr := func(typ string, multiValued bool, subAttrs ...*Attribute) *Attribute {
+		return &Attribute{
+			Name:          "foo",
+			Type:          typ,
+			MultiValued:   multiValued,
+			SubAttributes: subAttrs,
+			Assist:        &Assist{FullPath: "foo"},
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		attr   *Attribute
+		value  interface{}
+		expect interface{}
+		valid  bool
+	}{
+		{"string", attr(TypeString, false), "foo", "foo", true},
+		{"string with number", attr(TypeString, false), float64(1), nil, false},
+		{"boolean", attr(TypeBoolean, false), true, true, true},
+		{"boolean with string", attr(TypeBoolean, false), "true", nil, false},
+		{"integer from json number", attr(TypeInteger, false), float64(42), int64(42), true},
+		{"integer from int", attr(TypeInteger, false), 42, int64(42), true},
+		{"integer with fraction", attr(TypeInteger, false), 4.2, nil, false},
+		{"decimal from json number", attr(TypeDecimal, false), 4.2, 4.2, true},
+		{"decimal from int", attr(TypeDecimal, false), int64(4), float64(4), true},
+		{"datetime", attr(TypeDateTime, false), "2016-01-23T04:56:22Z", "2016-01-23T04:56:22Z", true},
+		{"datetime with offset", attr(TypeDateTime, false), "2016-01-23T04:56:22.123+09:00", "2016-01-23T04:56:22.123+09:00", true},
+		{"datetime without timezone", attr(TypeDateTime, false), "2016-01-23 04:56:22", nil, false},
+		{"binary", attr(TypeBinary, false), "aGVsbG8=", "aGVsbG8=", true},
+		{"binary not encoded", attr(TypeBinary, false), "hello!", nil, false},
+		{"reference", attr(TypeReference, false), "https://example.com/v2/Users/1", "https://example.com/v2/Users/1", true},
+		{"nil", attr(TypeInteger, false), nil, nil, true},
+		{"multivalued", attr(TypeInteger, true), []interface{}{float64(1), float64(2)}, []interface{}{int64(1), int64(2)}, true},
+		{"multivalued with single value", attr(TypeInteger, true), float64(1), nil, false},
+		{"multivalued with invalid element", attr(TypeInteger, true), []interface{}{float64(1), "2"}, nil, false},
+		{
+			"complex",
+			attr(TypeComplex, false, attr(TypeInteger, false)),
+			map[string]interface{}{"Foo": float64(1), "bar": "baz"},
+			map[string]interface{}{"Foo": int64(1), "bar": "baz"},
+			true,
+		},
+		{
+			"complex with invalid sub attribute",
+			attr(TypeComplex, false, attr(TypeInteger, false)),
+			map[string]interface{}{"foo": "1"},
+			nil,
+			false,
+		},
+		{"complex with string", attr(TypeComplex, false), "foo", nil, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := test.attr.Coerce(test.value)
+			if test.valid {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expect, v)
+			} else {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			}
+		})
+	}
+}
+
+func TestApplyPatchCoerce(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		name  string
+		patch Patch
+		valid bool
+	}{
+		{"replace boolean", Patch{Op: Replace, Path: "active", Value: false}, true},
+		{"replace boolean with string", Patch{Op: Replace, Path: "active", Value: "yes"}, false},
+		{"replace string with number", Patch{Op: Replace, Path: "nickName", Value: float64(1)}, false},
+		{"add element", Patch{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "a@foo.com", "primary": false}}, true},
+		{"add element with invalid sub attribute", Patch{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "a@foo.com", "primary": "no"}}, false},
+		{"add elements with invalid sub attribute", Patch{Op: Add, Path: "emails", Value: []interface{}{
+			map[string]interface{}{"value": "a@foo.com"},
+			map[string]interface{}{"value": float64(1)},
+		}}, false},
+		{"add implicit path with invalid value", Patch{Op: Add, Value: map[string]interface{}{"name": "foo"}}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{"userName": "david", "active": true}}
+			err := ApplyPatch(test.patch, resource, schema)
+			if test.valid {
+				assert.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			}
+		})
+	}
+}
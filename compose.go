@@ -0,0 +1,281 @@
+package scimpatch
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Compose the modifications into a single modification, which is equivalent to applying them in order.
+// Every operation is validated and its path resolved against the schema. Pathless add is broken up into an add for each
+// attribute, and the operations are then collapsed where the outcome stays the same:
+//   - operations overwritten by a later remove or replace of the same attribute are dropped, i.e. add-then-remove
+//   - adds to the same multivalued attribute are merged into a single add
+//   - elements added to a multivalued attribute and removed later by a filter are dropped from the add
+//   - removes by filter from the same multivalued attribute are merged into a single remove, joining the filters with 'or'
+//
+// Immutable attributes are never collapsed, since the outcome of writing them depends on the order. Neither are adds and
+// replaces through a filter overwritten, since they fail with noTarget when no element matches, and the composed
+// modification is to fail as the modifications do.
+func Compose(mods []Modification, schema *Schema) (Modification, error) {
+	composed := make([]*composedOp, 0)
+	for _, mod := range mods {
+		if err := mod.ValidateAgainst(schema); err != nil {
+			return Modification{}, err
+		}
+		for _, patch := range mod.Ops {
+			ops, err := newComposedOps(patch, schema)
+			if err != nil {
+				return Modification{}, err
+			}
+			for _, op := range ops {
+				composed = composeOp(composed, op)
+			}
+		}
+	}
+
+	ops := make([]Patch, 0, len(composed))
+	for _, op := range composed {
+		ops = append(ops, op.Patch)
+	}
+	return Modification{Schemas: []string{PatchOpUrn}, Ops: ops}, nil
+}
+
+// operation being composed, along with the attribute it writes to
+type composedOp struct {
+	Patch
+	attr   *Attribute
+	path   Path
+	key    string // full path of the attribute, in lower case
+	simple bool   // whether the path has no filter at all
+}
+
+func newComposedOps(patch Patch, schema *Schema) ([]*composedOp, error) {
+	patch.Op = strings.ToLower(patch.Op)
+	if len(patch.Path) == 0 {
+		pathless, err := pathlessOps(patch.Op, patch.Value, schema)
+		if err != nil {
+			return nil, err
+		}
+
+		ops := make([]*composedOp, 0)
+		for _, p := range pathless {
+			ops0, err := newComposedOps(p, schema)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, ops0...)
+		}
+		return ops, nil
+	}
+
+	path, err := NewPath(patch.Path)
+	if err != nil {
+		return nil, err
+	}
+	path.CorrectCase(schema, true)
+	attr := schema.GetAttribute(path, true)
+	if attr == nil {
+		return nil, errInvalidPath("No attribute found for path: %s", patch.Path)
+	}
+	patch.Path = path.CollectValue()
+
+	simple := true
+	for c := path; c != nil; c = c.Next() {
+		if c.FilterRoot() != nil {
+			simple = false
+		}
+	}
+
+	return []*composedOp{{
+		Patch:  patch,
+		attr:   attr,
+		path:   path,
+		key:    strings.ToLower(attr.Assist.FullPath),
+		simple: simple,
+	}}, nil
+}
+
+// last segment of the path, which holds the filter on the multivalued
+func (op *composedOp) last() Path {
+	c := op.path
+	for c.Next() != nil {
+		c = c.Next()
+	}
+	return c
+}
+
+// whether the two operations write to the same attribute, or one writes into the other
+func (op *composedOp) overlaps(other *composedOp) bool {
+	return op.key == other.key || withinKey(op.key, other.key) || withinKey(other.key, op.key)
+}
+
+// whether the full path is of a sub attribute of the other, including the attributes of a schema extension
+func withinKey(key, parent string) bool {
+	return strings.HasPrefix(key, parent+".") || strings.HasPrefix(key, parent+":")
+}
+
+// whether the operation leaves nothing of what the other operation wrote
+func (op *composedOp) overwrites(other *composedOp) bool {
+	if op.attr.Mutability == Immutable || other.attr.Mutability == Immutable {
+		return false
+	}
+	// an add or replace through a filter fails with noTarget when no element matches, which must not be composed away
+	if other.Op != Remove && !other.simple {
+		return false
+	}
+
+	switch op.Op {
+	case Remove:
+		if op.Value != nil {
+			return false
+		}
+	case Add:
+		if op.attr.MultiValued || op.attr.Type == TypeComplex {
+			return false
+		}
+	case Replace:
+		if op.attr.Type == TypeComplex && !op.attr.MultiValued {
+			return false
+		}
+	}
+
+	// moving the primary flag affects the other elements, which is undone only by overwriting the whole multivalued
+	if other.setsPrimary() && !(op.simple && op.attr.ExpectsComplexArray()) {
+		return false
+	}
+
+	if op.Patch.Path == other.Patch.Path && (op.last().FilterRoot() == nil || op.Op == Remove) {
+		return true
+	}
+	return op.simple && (op.key == other.key || withinKey(other.key, op.key))
+}
+
+// whether the operation flags an element as primary
+func (op *composedOp) setsPrimary() bool {
+	if op.Op == Remove {
+		return false
+	}
+	if strings.ToLower(op.attr.Name) == primaryKey {
+		primary, ok := op.Value.(bool)
+		return !ok || primary
+	}
+	for _, elem := range elementsOf(reflect.ValueOf(op.Value)) {
+		if isPrimary(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether the operation is a remove by filter of elements of the multivalued
+func (op *composedOp) removesByFilter() bool {
+	return op.Op == Remove && op.Value == nil && op.attr.MultiValued && op.last().FilterRoot() != nil
+}
+
+// whether the operation adds elements to the multivalued, at the same path as the other operation
+func (op *composedOp) addsElementsAt(other *composedOp) bool {
+	return op.Op == Add && op.attr.MultiValued && op.last().FilterRoot() == nil &&
+		op.attr.Mutability != Immutable && op.key == other.key && basePathText(op.path) == basePathText(other.path)
+}
+
+func composeOp(ops []*composedOp, op *composedOp) []*composedOp {
+	var removeTarget *composedOp
+	for i := len(ops) - 1; i >= 0; i-- {
+		prev := ops[i]
+		if !prev.overlaps(op) {
+			continue
+		}
+
+		switch {
+		case op.overwrites(prev):
+			ops = append(ops[:i], ops[i+1:]...)
+			continue
+
+		case op.removesByFilter() && prev.addsElementsAt(op):
+			if prev.stripElements(op) {
+				ops = append(ops[:i], ops[i+1:]...)
+			}
+			continue
+
+		case op.removesByFilter() && prev.removesByFilter() && basePathText(prev.path) == basePathText(op.path):
+			removeTarget = prev
+			continue
+
+		case op.addsElementsAt(prev) && prev.addsElementsAt(op) && removeTarget == nil:
+			if prev.mergeElements(op) {
+				return ops
+			}
+		}
+		break
+	}
+
+	if removeTarget != nil && removeTarget.joinFilter(op) {
+		return ops
+	}
+	return append(ops, op)
+}
+
+// Drop the elements added by the operation which are removed by the other operation later on.
+// Elements flagged as primary are kept, since adding them moves the flag away from the other elements.
+// Returns true if no element is left to add.
+func (op *composedOp) stripElements(remove *composedOp) bool {
+	remaining := make([]interface{}, 0)
+	for _, elem := range elementsOf(reflect.ValueOf(op.Value)) {
+		if m, ok := elem.(map[string]interface{}); ok && !isPrimary(m) && Complex(m).Evaluate(remove.last().FilterRoot(), op.attr) {
+			continue
+		}
+		remaining = append(remaining, elem)
+	}
+	op.Value = remaining
+	return len(remaining) == 0
+}
+
+// Merge the elements added by the other operation into the operation. Returns false if they cannot be merged, as
+// more than one element would be flagged as primary.
+func (op *composedOp) mergeElements(add *composedOp) bool {
+	elems := append(elementsOf(reflect.ValueOf(op.Value)), elementsOf(reflect.ValueOf(add.Value))...)
+	primaries := 0
+	for _, elem := range elems {
+		if isPrimary(elem) {
+			primaries++
+		}
+	}
+	if primaries > 1 {
+		return false
+	}
+	op.Value = elems
+	return true
+}
+
+// Join the filter of the other remove operation to the filter of the operation with 'or'.
+// Returns false if the joined filter cannot be parsed.
+func (op *composedOp) joinFilter(remove *composedOp) bool {
+	text := basePathText(op.path) + "[(" + filterText(op.last()) + ") or (" + filterText(remove.last()) + ")]"
+	path, err := NewPath(text)
+	if err != nil {
+		return false
+	}
+	op.Patch.Path = text
+	op.path = path
+	return true
+}
+
+// text of the path without the filter on the last segment
+func basePathText(p Path) string {
+	v, sep := "", ""
+	for c := p; c != nil; c = c.Next() {
+		text := c.Value()
+		if lbIdx := strings.Index(text, "["); c.Next() == nil && lbIdx != -1 {
+			text = text[:lbIdx]
+		}
+		v += sep + text
+		sep = segmentSeparator(c)
+	}
+	return v
+}
+
+// text of the filter of the segment, without the brackets
+func filterText(p Path) string {
+	text := p.Value()
+	return text[strings.Index(text, "[")+1 : len(text)-1]
+}
@@ -0,0 +1,230 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	require.Nil(t, err)
+
+	groupSchema := &Schema{}
+	err = json.Unmarshal([]byte(GroupSchemaJson), &groupSchema)
+	require.Nil(t, err)
+
+	user := Complex{
+		"userName": "david",
+		"nickName": "dave",
+		"name":     map[string]interface{}{"givenName": "David", "familyName": "Q"},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "david@example.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "david@home.com", "type": "home"},
+		},
+	}
+	group := Complex{
+		"displayName": "Tour Guides",
+		"members": []interface{}{
+			map[string]interface{}{"value": "first_member_id"},
+			map[string]interface{}{"value": "second_member_id"},
+		},
+	}
+	mod := func(ops ...Patch) Modification {
+		return Modification{Schemas: []string{PatchOpUrn}, Ops: ops}
+	}
+
+	for _, test := range []struct {
+		name     string
+		schema   *Schema
+		data     Complex
+		mods     []Modification
+		expected []Patch
+	}{
+		{
+			"repeated replaces",
+			userSchema,
+			user,
+			[]Modification{
+				mod(Patch{Op: "Replace", Path: "userName", Value: "foo"}),
+				mod(Patch{Op: "Replace", Path: "USERNAME", Value: "bar"}),
+			},
+			[]Patch{{Op: Replace, Path: "userName", Value: "bar"}},
+		},
+		{
+			"add then remove",
+			userSchema,
+			user,
+			[]Modification{
+				mod(Patch{Op: Add, Path: "displayName", Value: "David"}, Patch{Op: Replace, Path: "nickName", Value: "Q"}),
+				mod(Patch{Op: Remove, Path: "displayName"}),
+			},
+			[]Patch{
+				{Op: Replace, Path: "nickName", Value: "Q"},
+				{Op: Remove, Path: "displayName"},
+			},
+		},
+		{
+			"sub attributes overwritten by remove",
+			userSchema,
+			user,
+			[]Modification{
+				mod(Patch{Op: Replace, Path: "name.givenName", Value: "Dave"}, Patch{Op: Add, Path: "name.middleName", Value: "X"}),
+				mod(Patch{Op: Remove, Path: "name"}),
+			},
+			[]Patch{{Op: Remove, Path: "name"}},
+		},
+		{
+			"pathless add",
+			userSchema,
+			user,
+			[]Modification{
+				mod(Patch{Op: Add, Value: map[string]interface{}{"nickName": "Q", "displayName": "David"}}),
+				mod(Patch{Op: Replace, Path: "nickName", Value: "R"}),
+			},
+			[]Patch{
+				{Op: Add, Path: "displayName", Value: "David"},
+				{Op: Replace, Path: "nickName", Value: "R"},
+			},
+		},
+		{
+			"pathless add qualified by schema",
+			userSchema,
+			user,
+			[]Modification{
+				mod(Patch{Op: Add, Value: map[string]interface{}{"urn:ietf:params:scim:schemas:core:2.0:User:NICKNAME": "Q"}}),
+				mod(Patch{Op: Replace, Path: "nickName", Value: "R"}),
+			},
+			[]Patch{{Op: Replace, Path: "nickName", Value: "R"}},
+		},
+		{
+			"primary flag is kept",
+			userSchema,
+			user,
+			[]Modification{
+				mod(Patch{Op: Replace, Path: "emails[type eq \"home\"].primary", Value: true}),
+				mod(Patch{Op: Replace, Path: "emails[type eq \"home\"].primary", Value: false}),
+			},
+			[]Patch{
+				{Op: Replace, Path: "emails[type eq \"home\"].primary", Value: true},
+				{Op: Replace, Path: "emails[type eq \"home\"].primary", Value: false},
+			},
+		},
+		{
+			"member adds",
+			groupSchema,
+			group,
+			[]Modification{
+				mod(Patch{Op: Add, Path: "members", Value: []interface{}{map[string]interface{}{"value": "a"}}}),
+				mod(Patch{Op: Add, Path: "members", Value: map[string]interface{}{"value": "b"}}),
+			},
+			[]Patch{{Op: Add, Path: "members", Value: []interface{}{
+				map[string]interface{}{"value": "a"},
+				map[string]interface{}{"value": "b"},
+			}}},
+		},
+		{
+			"member add and remove pairs",
+			groupSchema,
+			group,
+			[]Modification{
+				mod(Patch{Op: Add, Path: "members", Value: []interface{}{
+					map[string]interface{}{"value": "a"},
+					map[string]interface{}{"value": "b"},
+				}}),
+				mod(Patch{Op: Remove, Path: "members[value eq \"a\"]"}),
+				mod(Patch{Op: Remove, Path: "members[value eq \"first_member_id\"]"}),
+				mod(Patch{Op: Add, Path: "members", Value: []interface{}{map[string]interface{}{"value": "c"}}}),
+			},
+			[]Patch{
+				{Op: Add, Path: "members", Value: []interface{}{map[string]interface{}{"value": "b"}}},
+				{Op: Remove, Path: "members[(value eq \"a\") or (value eq \"first_member_id\")]"},
+				{Op: Add, Path: "members", Value: []interface{}{map[string]interface{}{"value": "c"}}},
+			},
+		},
+		{
+			"member removed then added",
+			groupSchema,
+			group,
+			[]Modification{
+				mod(Patch{Op: Remove, Path: "members[value eq \"first_member_id\"]"}),
+				mod(Patch{Op: Add, Path: "members", Value: []interface{}{map[string]interface{}{"value": "first_member_id"}}}),
+			},
+			[]Patch{
+				{Op: Remove, Path: "members[value eq \"first_member_id\"]"},
+				{Op: Add, Path: "members", Value: []interface{}{map[string]interface{}{"value": "first_member_id"}}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			composed, err := Compose(test.mods, test.schema)
+			require.Nil(t, err)
+			assert.Equal(t, []string{PatchOpUrn}, composed.Schemas)
+			assert.Equal(t, test.expected, composed.Ops)
+
+			sequential := &Resource{test.data.Clone()}
+			for _, mod := range test.mods {
+				require.Nil(t, ApplyModification(mod, sequential, test.schema))
+			}
+			batched := &Resource{test.data.Clone()}
+			require.Nil(t, ApplyModification(composed, batched, test.schema))
+			for _, attr := range test.schema.Attributes {
+				actual, expected := batched.GetData()[attr.Name], sequential.GetData()[attr.Name]
+				if arr, ok := actual.([]interface{}); ok {
+					assert.True(t, sameElements(arr, expected.([]interface{})), attr.Name)
+				} else {
+					assert.Equal(t, expected, actual, attr.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestComposeInvalid(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	_, err = Compose([]Modification{
+		{Schemas: []string{PatchOpUrn}, Ops: []Patch{{Op: Replace, Path: "userName", Value: "foo"}}},
+		{Schemas: []string{PatchOpUrn}, Ops: []Patch{{Op: Replace, Path: "unknown", Value: "foo"}}},
+	}, schema)
+	require.NotNil(t, err)
+	assert.Equal(t, ScimTypeInvalidPath, AsError(err).ScimType)
+
+	_, err = Compose([]Modification{
+		{Schemas: []string{PatchOpUrn}, Ops: []Patch{{Op: "move", Path: "userName"}}},
+	}, schema)
+	require.NotNil(t, err)
+	assert.Equal(t, ScimTypeInvalidSyntax, AsError(err).ScimType)
+}
+
+func TestComposeFailing(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	user := Complex{
+		"userName": "david",
+		"emails": []interface{}{
+			map[string]interface{}{"value": "david@example.com", "type": "work"},
+		},
+	}
+	mods := []Modification{
+		{Schemas: []string{PatchOpUrn}, Ops: []Patch{{Op: Replace, Path: "emails[type eq \"home\"]", Value: map[string]interface{}{"value": "x@example.com"}}}},
+		{Schemas: []string{PatchOpUrn}, Ops: []Patch{{Op: Replace, Path: "emails", Value: []interface{}{map[string]interface{}{"value": "y@example.com"}}}}},
+	}
+
+	err = ApplyModification(mods[0], &Resource{user.Clone()}, schema)
+	require.NotNil(t, err)
+	assert.Equal(t, ScimTypeNoTarget, AsError(err).ScimType)
+
+	composed, err := Compose(mods, schema)
+	require.Nil(t, err)
+	assert.Equal(t, []Patch{mods[0].Ops[0], mods[1].Ops[0]}, composed.Ops)
+	err = ApplyModification(composed, &Resource{user.Clone()}, schema)
+	require.NotNil(t, err)
+	assert.Equal(t, ScimTypeNoTarget, AsError(err).ScimType)
+}
@@ -0,0 +1,250 @@
+package scimpatch
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Dialect of a SCIM client, which tolerates the ways the client deviates from RFC 7644.
+// The dialect is selected per call with WithDialect, and AzureAD is used when none is selected.
+type Dialect interface {
+	Name() string                                               // name to look up the dialect by, see LookupDialect
+	PreparePatch(patch Patch) (Patch, error)                    // pre-process the patch before its path is parsed, or reject it
+	RewritePath(patch Patch, attr *Attribute) (string, error)   // rewrite the path of the patch, given the attribute it resolves to, or reject it
+	CoerceValue(attr *Attribute, value interface{}) interface{} // fix the value before it is checked against the attribute type
+}
+
+// Built-in dialects
+var (
+	// Azure AD sends removal of elements with the elements in the value instead of a filter, single values wrapped in
+	// arrays or objects, and booleans as "True" or "False"
+	AzureAD Dialect = &quirkDialect{name: "azuread", removeByValue: true, unwrapValues: true}
+	// Okta sends booleans as strings
+	Okta Dialect = &quirkDialect{name: "okta", booleanStrings: true}
+	// OneLogin sends single values wrapped in arrays or objects, and booleans as strings
+	OneLogin Dialect = &quirkDialect{name: "onelogin", unwrapValues: true, booleanStrings: true}
+	// JumpCloud sends removal of elements with the elements in the value instead of a filter, and booleans as strings
+	JumpCloud Dialect = &quirkDialect{name: "jumpcloud", removeByValue: true, booleanStrings: true}
+	// Strict follows RFC 7644 to the letter, and tolerates nothing
+	Strict Dialect = &quirkDialect{name: "strict"}
+)
+
+var (
+	dialectsMutex sync.RWMutex
+	dialects      = map[string]Dialect{}
+)
+
+func init() {
+	for _, d := range []Dialect{AzureAD, Okta, OneLogin, JumpCloud, Strict} {
+		RegisterDialect(d)
+	}
+}
+
+// Register the dialect by its name, replacing the dialect registered by the same name if any
+func RegisterDialect(d Dialect) {
+	dialectsMutex.Lock()
+	defer dialectsMutex.Unlock()
+	dialects[strings.ToLower(d.Name())] = d
+}
+
+// Look up the registered dialect by its name, ignoring the case
+func LookupDialect(name string) (Dialect, bool) {
+	dialectsMutex.RLock()
+	defer dialectsMutex.RUnlock()
+	d, ok := dialects[strings.ToLower(name)]
+	return d, ok
+}
+
+// Names of the registered dialects, in alphabetical order
+func DialectNames() []string {
+	dialectsMutex.RLock()
+	defer dialectsMutex.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dialect made up of the known deviations from RFC 7644
+type quirkDialect struct {
+	name           string
+	removeByValue  bool // removal of elements specifies the elements in the value instead of a filter
+	unwrapValues   bool // single-valued string and boolean attributes are sent wrapped in arrays or objects
+	booleanStrings bool // booleans are sent as strings, ignoring the case
+}
+
+func (d *quirkDialect) Name() string {
+	return d.name
+}
+
+func (d *quirkDialect) PreparePatch(patch Patch) (Patch, error) {
+	return patch, nil
+}
+
+func (d *quirkDialect) RewritePath(patch Patch, attr *Attribute) (string, error) {
+	if d.removeByValue {
+		return removeByValuePath(patch, attr)
+	}
+	return patch.Path, nil
+}
+
+func (d *quirkDialect) CoerceValue(attr *Attribute, value interface{}) interface{} {
+	if d.unwrapValues && value != nil {
+		value = fixValueWithType(attr, reflect.ValueOf(value)).Interface()
+	}
+	if s, ok := value.(string); ok && d.booleanStrings && attr.ExpectsBool() {
+		switch strings.ToLower(s) {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+	return value
+}
+
+// [AzureAD対策]
+// 忌まわしきAzureADのバグとしてそもそも配列値からの要素削除のリクエストがおかしいというものがあり、ここのコードでその対策をしている
+// RFC上は配列からの要素の削除は `members[value eq "target_member_id"]` のようなフィルタクエリで削除対象を指定するものであるが
+// AzureADはなぜかフィルタクエリを使わず、削除対象の要素をvalueフィールドで指定して削除しようとしてくる。
+// そもそもgo-scimpatchはRFCに沿って作られたものであるため、こういうそもそもRFCに則ってないリクエストを受け付けるような動きにはなっていない。
+// したがって、このようなAzureADの動きに対応するようなグルーコードもどきを仕方なく作ることとなった。
+//
+// 削除対象の要素は複数指定されることもあるため、valueフィールドの値をすべて拾って `members[value eq "a" or value eq "b"]` のような
+// フィルタに展開する。要素はオブジェクトの場合も文字列の場合もある。
+// フィルタはエスケープを持たないため、文字列のvalueを持たない要素や `"` `[` `]` を含む値は黙って無視せずinvalidValueとする。
+// 既にフィルタで削除対象が指定されている場合はRFCに沿ったリクエストなので書き換えない。
+func removeByValuePath(patch Patch, attr *Attribute) (string, error) {
+	if strings.ToLower(patch.Op) == Remove && attr.MultiValued && patch.Value != nil && !filtersLast(patch.Path) {
+		values, err := removedValues(patch.Value)
+		if err != nil {
+			return "", err
+		}
+		conditions := make([]string, 0)
+		for _, value := range values {
+			conditions = append(conditions, "value eq \""+value+"\"")
+		}
+		if len(conditions) == 0 {
+			// 何も指定されていないのに要素をすべて削除してしまわないよう、どの要素にも一致しないフィルタにしておく
+			conditions = append(conditions, "value eq \"\"")
+		}
+		return patch.Path + "[" + strings.Join(conditions, " or ") + "]", nil
+	}
+
+	return patch.Path, nil
+}
+
+// whether the last segment of the path has a filter
+func filtersLast(text string) bool {
+	p, err := NewPath(text)
+	if err != nil {
+		return false
+	}
+	_, last := p.SeparateAtLast()
+	return last.FilterRoot() != nil
+}
+
+// values of the elements to remove, given either as an element, its value, or an array of them.
+// Fails with invalidValue on a value which cannot be written in a filter.
+func removedValues(value interface{}) ([]string, error) {
+	values := make([]string, 0)
+	seen := make(map[string]bool)
+	var collect func(v interface{}) error
+	collect = func(v interface{}) error {
+		switch v0 := v.(type) {
+		case []interface{}:
+			for _, elem := range v0 {
+				if err := collect(elem); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			s, ok := lookup(v0, "value").(string)
+			if !ok {
+				return errInvalidValue("Invalid parameter: element to remove has no value: %v", v0)
+			}
+			return collect(s)
+		case string:
+			if strings.ContainsAny(v0, "\"[]") {
+				return errInvalidValue("Invalid parameter: value to remove cannot be written in a filter: %s", v0)
+			}
+			if !seen[v0] {
+				seen[v0] = true
+				values = append(values, v0)
+			}
+		default:
+			return errInvalidValue("Invalid parameter: value to remove is not a string: %v", v0)
+		}
+		return nil
+	}
+	if err := collect(value); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// [AzureAD対策]
+// 特定のSCIMクライアントがstring型のフィールドに対して配列値を送ってくることがある
+// なので、配列やオブジェクトが値として送られてきた場合にはここで取り出して単一値として与えたい。
+// 雑な実装として配列値が与えられた場合には必ず配列の先頭のオブジェクトから常にvalueフィールドを対象のデータとして取り出すことにする。
+// https://social.msdn.microsoft.com/Forums/lync/en-US/e2200b69-4333-41ea-9f51-717d316c7751/automatic-user-provisioning-scim-restful-patch-payload-issue
+func fixValueWithType(destAttr *Attribute, value reflect.Value) reflect.Value {
+	valueKind := value.Kind()
+
+	// ここでps.destAttrのチェックをしているのはimplicit pathというpathを直接指定せずにデータの追加をするためのテストケースがあるため
+	// 実際にはSCIMのRFCを読んでも規約としては存在していなさそうなので、path指定は必須項目としたいが一旦ここではnilチェックに留めておく。
+	if destAttr != nil {
+		isValueAndTypeUnmatched :=
+			(destAttr.Type == "string" && valueKind != reflect.String) ||
+				(destAttr.Type == "boolean" && valueKind != reflect.Bool)
+
+		if isValueAndTypeUnmatched {
+			var v reflect.Value
+
+			// Mapであればそこからvalueフィールドを取り出す
+			// Slice/Arrayであればその先頭要素のオブジェクトからvalueフィールドを取り出す
+			// 取り出せない値はそのまま返して、属性の型チェックでinvalidValueとする
+			switch valueKind {
+			case reflect.Map:
+				mapValue, ok := value.Interface().(map[string]interface{})
+				if !ok {
+					return value
+				}
+				v = reflect.ValueOf(mapValue["value"])
+			case reflect.Slice, reflect.Array:
+				arrayValue, ok := value.Interface().([]interface{})
+				if !ok || len(arrayValue) == 0 {
+					return value
+				}
+				head, ok := arrayValue[0].(map[string]interface{})
+				if !ok {
+					return value
+				}
+				v = reflect.ValueOf(head["value"])
+			default:
+				v = value
+			}
+			if !v.IsValid() {
+				return value
+			}
+
+			// これもAzureADだがbooleanの値をPascalCaseで送ってくるためパースできない。
+			// なのでもしその文字列がTrue/Falseであればそれをbool値に変換する
+			s, _ := v.Interface().(string)
+			switch s {
+			case "True":
+				v = reflect.ValueOf(true)
+			case "False":
+				v = reflect.ValueOf(false)
+			}
+
+			return v
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,213 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// dialect of a client which sends the work email under an alias
+type aliasDialect struct {
+	Dialect
+}
+
+func (d aliasDialect) Name() string {
+	return "alias"
+}
+
+func (d aliasDialect) PreparePatch(patch Patch) (Patch, error) {
+	if strings.ToLower(patch.Path) == "workemail" {
+		patch.Path = "emails[type eq \"work\"].value"
+	}
+	return patch, nil
+}
+
+func TestDialect(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	require.Nil(t, err)
+
+	groupSchema := &Schema{}
+	err = json.Unmarshal([]byte(GroupSchemaJson), &groupSchema)
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		schema    *Schema
+		patch     Patch
+		dialect   Dialect
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"AzureAD is the default",
+			userSchema,
+			Patch{Op: Replace, Path: "active", Value: "False"},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, false, r.GetData()["active"])
+			},
+		},
+		{
+			"Strict rejects boolean as string",
+			userSchema,
+			Patch{Op: Replace, Path: "active", Value: "False"},
+			Strict,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			},
+		},
+		{
+			"Strict rejects wrapped value",
+			userSchema,
+			Patch{Op: Replace, Path: "userName", Value: []interface{}{map[string]interface{}{"value": "foo"}}},
+			Strict,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+				assert.Equal(t, "david", r.GetData()["userName"])
+			},
+		},
+		{
+			"OneLogin unwraps value",
+			userSchema,
+			Patch{Op: Replace, Path: "userName", Value: []interface{}{map[string]interface{}{"value": "foo"}}},
+			OneLogin,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", r.GetData()["userName"])
+			},
+		},
+		{
+			"AzureAD rejects number for string",
+			userSchema,
+			Patch{Op: Replace, Path: "userName", Value: 1},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+				assert.Contains(t, err.Error(), "expected string but got 1")
+				assert.Equal(t, "david", r.GetData()["userName"])
+			},
+		},
+		{
+			"AzureAD rejects empty array for string",
+			userSchema,
+			Patch{Op: Replace, Path: "userName", Value: []interface{}{}},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+				assert.Equal(t, "david", r.GetData()["userName"])
+			},
+		},
+		{
+			"AzureAD rejects array of strings for string",
+			userSchema,
+			Patch{Op: Replace, Path: "userName", Value: []interface{}{"foo", map[string]interface{}{"value": "bar"}}},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+				assert.Equal(t, "david", r.GetData()["userName"])
+			},
+		},
+		{
+			"Okta accepts boolean as string",
+			userSchema,
+			Patch{Op: Replace, Path: "active", Value: "false"},
+			Okta,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, false, r.GetData()["active"])
+			},
+		},
+		{
+			"Okta rejects wrapped value",
+			userSchema,
+			Patch{Op: Replace, Path: "userName", Value: map[string]interface{}{"value": "foo"}},
+			Okta,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			},
+		},
+		{
+			"JumpCloud removes by value",
+			groupSchema,
+			Patch{Op: Remove, Path: "members", Value: []interface{}{map[string]interface{}{"value": "first_member_id"}}},
+			JumpCloud,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{map[string]interface{}{"value": "second_member_id"}}, r.GetData()["members"])
+			},
+		},
+		{
+			"AzureAD keeps filter of remove with value",
+			userSchema,
+			Patch{Op: Remove, Path: "emails[type eq \"work\"]", Value: []interface{}{map[string]interface{}{"value": "david@example.com"}}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				_, ok := r.GetData()["emails"]
+				assert.False(t, ok)
+			},
+		},
+		{
+			"Strict does not remove by value",
+			groupSchema,
+			Patch{Op: Remove, Path: "members[value eq \"second_member_id\"]", Value: []interface{}{map[string]interface{}{"value": "first_member_id"}}},
+			Strict,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{map[string]interface{}{"value": "first_member_id"}}, r.GetData()["members"])
+			},
+		},
+		{
+			"custom dialect",
+			userSchema,
+			Patch{Op: Replace, Path: "workEmail", Value: "foo@bar.com"},
+			aliasDialect{Strict},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo@bar.com", r.GetData()["emails"].([]interface{})[0].(map[string]interface{})["value"])
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{
+				"userName": "david",
+				"active":   true,
+				"emails": []interface{}{
+					map[string]interface{}{"value": "david@example.com", "type": "work"},
+				},
+				"members": []interface{}{
+					map[string]interface{}{"value": "first_member_id"},
+					map[string]interface{}{"value": "second_member_id"},
+				},
+			}}
+			err := ApplyPatch(test.patch, resource, test.schema, WithDialect(test.dialect))
+			test.assertion(resource, err)
+		})
+	}
+}
+
+func TestDialectRegistry(t *testing.T) {
+	for _, name := range []string{"AzureAD", "okta", "OneLogin", "jumpcloud", "STRICT"} {
+		d, ok := LookupDialect(name)
+		require.True(t, ok, name)
+		assert.Equal(t, strings.ToLower(name), d.Name())
+	}
+
+	_, ok := LookupDialect("alias")
+	assert.False(t, ok)
+
+	RegisterDialect(aliasDialect{Strict})
+	d, ok := LookupDialect("Alias")
+	require.True(t, ok)
+	assert.Equal(t, "alias", d.Name())
+	assert.Equal(t, []string{"alias", "azuread", "jumpcloud", "okta", "onelogin", "strict"}, DialectNames())
+}
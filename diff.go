@@ -0,0 +1,265 @@
+package scimpatch
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Compute the modification which transforms the resource 'from' into the resource 'to' when applied with ApplyModification.
+// Read only attributes are left out, since they cannot be patched. Complex attributes are patched down to the sub attributes
+// that differ, and elements of multivalued complex attributes are added, replaced or removed one by one through filter paths
+// built from Assist.ArrayIndexKey, i.e. 'emails[value eq "x"]'. Multivalued attributes whose elements cannot be identified
+// that way are replaced as a whole. The order of the elements is not preserved, as it carries no meaning in SCIM.
+// The modification has no operations when the resources do not differ.
+func Diff(from, to *Resource, schema *Schema) Modification {
+	return diff(from, to, schema, false)
+}
+
+// compute the modification, which also preserves the order of the elements when exact
+func diff(from, to *Resource, schema *Schema, exact bool) Modification {
+	d := &differ{sch: schema, from: from, exact: exact, ops: make([]Patch, 0)}
+	d.diffComplex("", schema.Attributes, from.Complex, to.Complex)
+	return Modification{Schemas: []string{PatchOpUrn}, Ops: d.ops}
+}
+
+type differ struct {
+	sch   *Schema
+	from  *Resource
+	exact bool // whether the order of the elements has to be preserved
+	ops   []Patch
+}
+
+func (d *differ) emit(op, path string, value interface{}) {
+	d.ops = append(d.ops, Patch{Op: op, Path: path, Value: deepCopy(value)})
+}
+
+func (d *differ) diffComplex(prefix string, attrs []*Attribute, x, y map[string]interface{}) {
+	for _, attr := range attrs {
+		if attr.Mutability == ReadOnly {
+			continue
+		}
+		d.diffAttribute(prefix+attr.Name, attr, lookup(x, attr.Name), lookup(y, attr.Name))
+	}
+}
+
+func (d *differ) diffAttribute(p string, attr *Attribute, x, y interface{}) {
+	xAssigned, yAssigned := attr.Assigned(reflect.ValueOf(x)), attr.Assigned(reflect.ValueOf(y))
+	switch {
+	case !xAssigned && !yAssigned:
+	case !yAssigned:
+		d.emit(Remove, p, nil)
+	case !xAssigned:
+		d.emit(Add, p, y)
+	case identical(x, y):
+	case attr.ExpectsComplex():
+		mx, okx := x.(map[string]interface{})
+		my, oky := y.(map[string]interface{})
+		if okx && oky {
+			d.diffComplex(subPathPrefix(p, attr), attr.SubAttributes, mx, my)
+		} else {
+			d.emit(Replace, p, y)
+		}
+	case attr.ExpectsComplexArray():
+		ax, okx := x.([]interface{})
+		ay, oky := y.([]interface{})
+		if okx && oky {
+			if ops, ok := d.diffElements(p, attr, ax, ay); ok {
+				d.ops = append(d.ops, ops...)
+				return
+			}
+		}
+		d.emit(Replace, p, y)
+	default:
+		d.emit(Replace, p, y)
+	}
+}
+
+// Operations patching the elements of the multivalued one by one, false if the elements cannot be identified by filters
+// or the operations do not yield the expected elements.
+func (d *differ) diffElements(p string, attr *Attribute, x, y []interface{}) ([]Patch, bool) {
+	removes, replaces, adds := make([]Patch, 0), make([]Patch, 0), make([]interface{}, 0)
+	matched := make([]bool, len(y))
+	for i, elem := range x {
+		filterPath, root, ok := elementFilter(p, attr, MultiValued(x), i)
+		if !ok {
+			return nil, false
+		}
+
+		j := -1
+		for k, other := range y {
+			if m, ok := other.(map[string]interface{}); ok && Complex(m).Evaluate(root, attr) {
+				if j >= 0 || matched[k] {
+					return nil, false
+				}
+				j = k
+			}
+		}
+
+		switch {
+		case j < 0:
+			removes = append(removes, Patch{Op: Remove, Path: filterPath})
+		case identical(elem, y[j]):
+			matched[j] = true
+		case covers(y[j], elem):
+			matched[j] = true
+			replaces = append(replaces, Patch{Op: Replace, Path: filterPath, Value: deepCopy(y[j])})
+		default:
+			matched[j] = true
+			removes = append(removes, Patch{Op: Remove, Path: filterPath})
+			adds = append(adds, deepCopy(y[j]))
+		}
+	}
+	for j, elem := range y {
+		if !matched[j] {
+			adds = append(adds, deepCopy(elem))
+		}
+	}
+
+	ops := append(removes, replaces...)
+	if len(adds) > 0 {
+		ops = append(ops, Patch{Op: Add, Path: p, Value: adds})
+	}
+	return ops, d.yields(p, attr, ops, y)
+}
+
+// whether the operations applied to a copy of the original resource yield the expected elements of the multivalued,
+// in the same order if exact
+func (d *differ) yields(p string, attr *Attribute, ops []Patch, expected []interface{}) bool {
+	working := &Resource{d.from.Complex.Clone()}
+	if err := ApplyModification(Modification{Schemas: []string{PatchOpUrn}, Ops: ops}, working, d.sch); err != nil {
+		return false
+	}
+
+	path, err := NewPath(p)
+	if err != nil {
+		return false
+	}
+	actual := make([]interface{}, 0)
+	for v := range working.Get(path, d.sch) {
+		if arr, ok := v.([]interface{}); ok {
+			actual = append(actual, arr...)
+		}
+	}
+	if d.exact {
+		return identical(actual, expected)
+	}
+	return sameElements(actual, expected)
+}
+
+// Path with the filter identifying the element at the index of the multivalued, along with the root of the filter.
+// false if the sub attributes in Assist.ArrayIndexKey do not single out the element.
+func elementFilter(p string, attr *Attribute, mv MultiValued, index int) (string, FilterNode, bool) {
+	elem, ok := mv.Get(index).(map[string]interface{})
+	if !ok || attr.Assist == nil {
+		return "", nil, false
+	}
+
+	conditions := make([]string, 0)
+	for _, key := range attr.Assist.ArrayIndexKey {
+		switch v := lookup(elem, key).(type) {
+		case nil:
+		case string:
+			if strings.ContainsAny(v, "\"[]") {
+				return "", nil, false
+			}
+			conditions = append(conditions, fmt.Sprintf("%s eq \"%s\"", key, v))
+		case bool, int, int32, int64, float32, float64:
+			conditions = append(conditions, fmt.Sprintf("%s eq %v", key, v))
+		default:
+			return "", nil, false
+		}
+	}
+	if len(conditions) == 0 {
+		return "", nil, false
+	}
+
+	filterPath := fmt.Sprintf("%s[%s]", p, strings.Join(conditions, " and "))
+	parsed, err := NewPath(filterPath)
+	if err != nil {
+		return "", nil, false
+	}
+	for parsed.Next() != nil {
+		parsed = parsed.Next()
+	}
+	if indexes := mv.FindIndex(parsed.FilterRoot(), attr); len(indexes) != 1 || indexes[0] != index {
+		return "", nil, false
+	}
+	return filterPath, parsed.FilterRoot(), true
+}
+
+// whether the two values are the same, regardless of the representation of numbers
+func identical(x, y interface{}) bool {
+	switch x0 := x.(type) {
+	case map[string]interface{}:
+		y0, ok := y.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range x0 {
+			if !identical(v, y0[k]) {
+				return false
+			}
+		}
+		for k, v := range y0 {
+			if _, ok := x0[k]; !ok && v != nil {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y0, ok := y.([]interface{})
+		if !ok || len(x0) != len(y0) {
+			return false
+		}
+		for i := range x0 {
+			if !identical(x0[i], y0[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	fx, okx := toFloat(x)
+	fy, oky := toFloat(y)
+	if okx && oky {
+		return fx == fy
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// whether merging the element x into the element y, as replace does, yields x
+func covers(x, y interface{}) bool {
+	mx, okx := x.(map[string]interface{})
+	my, oky := y.(map[string]interface{})
+	if !okx || !oky {
+		return false
+	}
+	for k, v := range my {
+		if v0, ok := mx[k]; v != nil && (!ok || v0 == nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// whether the two multivalued hold the same elements, regardless of the order
+func sameElements(x, y []interface{}) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	used := make([]bool, len(y))
+	for _, elem := range x {
+		found := false
+		for j := range y {
+			if !used[j] && identical(elem, y[j]) {
+				used[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
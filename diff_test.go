@@ -0,0 +1,148 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		from      Complex
+		to        Complex
+		assertion func(ops []Patch)
+	}{
+		{
+			"no difference",
+			Complex{"userName": "david", "active": true},
+			Complex{"userName": "david", "active": true},
+			func(ops []Patch) {
+				assert.Equal(t, 0, len(ops))
+			},
+		},
+		{
+			"simple attributes",
+			Complex{"userName": "david", "nickName": "dave", "active": true},
+			Complex{"userName": "david2", "displayName": "David", "active": true},
+			func(ops []Patch) {
+				assert.Equal(t, []Patch{
+					{Op: Replace, Path: "userName", Value: "david2"},
+					{Op: Add, Path: "displayName", Value: "David"},
+					{Op: Remove, Path: "nickName"},
+				}, ops)
+			},
+		},
+		{
+			"complex sub attributes",
+			Complex{"name": map[string]interface{}{"givenName": "David", "familyName": "Q", "middleName": "X"}},
+			Complex{"name": map[string]interface{}{"givenName": "Dave", "familyName": "Q", "formatted": "Dave Q"}},
+			func(ops []Patch) {
+				assert.Equal(t, []Patch{
+					{Op: Add, Path: "name.formatted", Value: "Dave Q"},
+					{Op: Replace, Path: "name.givenName", Value: "Dave"},
+					{Op: Remove, Path: "name.middleName"},
+				}, ops)
+			},
+		},
+		{
+			"read only attributes",
+			Complex{"id": "1", "meta": map[string]interface{}{"version": "1"}},
+			Complex{"id": "2", "meta": map[string]interface{}{"version": "2"}},
+			func(ops []Patch) {
+				assert.Equal(t, 0, len(ops))
+			},
+		},
+		{
+			"multivalued elements",
+			Complex{"emails": []interface{}{
+				map[string]interface{}{"value": "a@example.com", "type": "work"},
+				map[string]interface{}{"value": "b@example.com", "type": "home"},
+				map[string]interface{}{"value": "c@example.com", "type": "other", "display": "c"},
+			}},
+			Complex{"emails": []interface{}{
+				map[string]interface{}{"value": "a@example.com", "type": "work"},
+				map[string]interface{}{"value": "c@example.com", "type": "home"},
+				map[string]interface{}{"value": "d@example.com", "type": "other"},
+			}},
+			func(ops []Patch) {
+				assert.Equal(t, []Patch{
+					{Op: Remove, Path: "emails[value eq \"b@example.com\"]"},
+					{Op: Remove, Path: "emails[value eq \"c@example.com\"]"},
+					{Op: Add, Path: "emails", Value: []interface{}{
+						map[string]interface{}{"value": "c@example.com", "type": "home"},
+						map[string]interface{}{"value": "d@example.com", "type": "other"},
+					}},
+				}, ops)
+			},
+		},
+		{
+			"multivalued element replaced",
+			Complex{"emails": []interface{}{
+				map[string]interface{}{"value": "a@example.com", "type": "work", "primary": true},
+			}},
+			Complex{"emails": []interface{}{
+				map[string]interface{}{"value": "a@example.com", "type": "home", "primary": true},
+			}},
+			func(ops []Patch) {
+				assert.Equal(t, []Patch{
+					{Op: Replace, Path: "emails[value eq \"a@example.com\"]", Value: map[string]interface{}{"value": "a@example.com", "type": "home", "primary": true}},
+				}, ops)
+			},
+		},
+		{
+			"multivalued elements without index key",
+			Complex{"emails": []interface{}{
+				map[string]interface{}{"type": "work"},
+			}},
+			Complex{"emails": []interface{}{
+				map[string]interface{}{"type": "home"},
+			}},
+			func(ops []Patch) {
+				assert.Equal(t, []Patch{
+					{Op: Replace, Path: "emails", Value: []interface{}{map[string]interface{}{"type": "home"}}},
+				}, ops)
+			},
+		},
+		{
+			"multivalued with multiple index keys",
+			Complex{"addresses": []interface{}{
+				map[string]interface{}{"locality": "Tokyo", "type": "work"},
+				map[string]interface{}{"locality": "Tokyo", "type": "home"},
+			}},
+			Complex{"addresses": []interface{}{
+				map[string]interface{}{"locality": "Tokyo", "type": "work"},
+			}},
+			func(ops []Patch) {
+				assert.Equal(t, []Patch{
+					{Op: Remove, Path: "addresses[locality eq \"Tokyo\" and type eq \"home\"]"},
+				}, ops)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			from := &Resource{test.from.Clone()}
+			to := &Resource{test.to.Clone()}
+
+			mod := Diff(from, to, schema)
+			assert.Equal(t, []string{PatchOpUrn}, mod.Schemas)
+			test.assertion(mod.Ops)
+
+			require.Nil(t, ApplyModification(mod, from, schema))
+			for _, attr := range schema.Attributes {
+				if attr.Mutability != ReadOnly {
+					assert.True(t, identical(from.GetData()[attr.Name], to.GetData()[attr.Name]) ||
+						(attr.MultiValued && sameElements(
+							from.GetData()[attr.Name].([]interface{}),
+							to.GetData()[attr.Name].([]interface{}),
+						)), attr.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SCIM error types, see RFC 7644 section 3.12
+const (
+	ScimTypeInvalidFilter = "invalidFilter"
+	ScimTypeTooMany       = "tooMany"
+	ScimTypeUniqueness    = "uniqueness"
+	ScimTypeMutability    = "mutability"
+	ScimTypeInvalidSyntax = "invalidSyntax"
+	ScimTypeInvalidPath   = "invalidPath"
+	ScimTypeNoTarget      = "noTarget"
+	ScimTypeInvalidValue  = "invalidValue"
+	ScimTypeInvalidVers   = "invalidVers"
+	ScimTypeSensitive     = "sensitive"
+)
+
+// SCIM error, carrying the scimType and the HTTP status to respond with
+type Error struct {
+	ScimType string // one of the SCIM error types, empty when no type applies
+	Status   int    // HTTP status code
+	Detail   string // human readable description of the error
+	Location string // part of the request the error was found in, such as Operations[2].path, empty when unknown
+}
+
+func (e *Error) Error() string {
+	if len(e.Location) > 0 {
+		return e.Location + ": " + e.Detail
+	}
+	return e.Detail
+}
+
+// copy of the error located in the part of the request, which contains the part the error was located in so far
+func (e *Error) at(location string) *Error {
+	located := *e
+	if len(e.Location) > 0 {
+		location += "." + e.Location
+	}
+	located.Location = location
+	return &located
+}
+
+// Render the error as the body of a SCIM error response
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+		Status   string   `json:"status"`
+	}{
+		[]string{ErrorUrn},
+		e.ScimType,
+		e.Error(),
+		strconv.Itoa(e.Status),
+	})
+}
+
+// Multiple SCIM errors reported at once, in the order they were found
+type Errors []*Error
+
+func (e Errors) Error() string {
+	details := make([]string, 0, len(e))
+	for _, err := range e {
+		details = append(details, err.Error())
+	}
+	return strings.Join(details, "; ")
+}
+
+// nil if there is no error, so that the errors can be returned as error
+func (e Errors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Convert any error into a SCIM error. Errors which do not originate from this package are regarded as
+// internal server errors. Multiple errors are merged into one, taking the type and status of the first error.
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var errs Errors
+	if errors.As(err, &errs) && len(errs) > 0 {
+		return &Error{ScimType: errs[0].ScimType, Status: errs[0].Status, Detail: errs.Error()}
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Status: http.StatusInternalServerError, Detail: err.Error()}
+}
+
+// Render any error as the body of a SCIM error response, returning the HTTP status along with it.
+// No error renders as http.StatusOK without a body.
+func RenderError(err error) (int, []byte) {
+	if err == nil {
+		return http.StatusOK, nil
+	}
+	e := AsError(err)
+	body, _ := json.Marshal(e)
+	return e.Status, body
+}
+
+func newError(scimType string, status int, format string, args ...interface{}) *Error {
+	return &Error{ScimType: scimType, Status: status, Detail: fmt.Sprintf(format, args...)}
+}
+
+func errInvalidFilter(format string, args ...interface{}) *Error {
+	return newError(ScimTypeInvalidFilter, http.StatusBadRequest, format, args...)
+}
+
+func errInvalidSyntax(format string, args ...interface{}) *Error {
+	return newError(ScimTypeInvalidSyntax, http.StatusBadRequest, format, args...)
+}
+
+func errInvalidPath(format string, args ...interface{}) *Error {
+	return newError(ScimTypeInvalidPath, http.StatusBadRequest, format, args...)
+}
+
+func errNoTarget(format string, args ...interface{}) *Error {
+	return newError(ScimTypeNoTarget, http.StatusBadRequest, format, args...)
+}
+
+func errInvalidValue(format string, args ...interface{}) *Error {
+	return newError(ScimTypeInvalidValue, http.StatusBadRequest, format, args...)
+}
+
+func errMutability(format string, args ...interface{}) *Error {
+	return newError(ScimTypeMutability, http.StatusBadRequest, format, args...)
+}
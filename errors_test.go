@@ -0,0 +1,146 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestErrorScimType(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		name     string
+		run      func() error
+		scimType string
+	}{
+		{
+			"invalid path",
+			func() error {
+				_, err := NewPath("emails[type eq \"work\"")
+				return err
+			},
+			ScimTypeInvalidPath,
+		},
+		{
+			"invalid filter",
+			func() error {
+				_, err := NewFilter("(type eq \"work\"")
+				return err
+			},
+			ScimTypeInvalidFilter,
+		},
+		{
+			"invalid filter in path",
+			func() error {
+				_, err := NewPath("emails[(type eq \"work\"]")
+				return err
+			},
+			ScimTypeInvalidFilter,
+		},
+		{
+			"remove without path",
+			func() error {
+				return Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{{Op: Remove}}}.Validate()
+			},
+			ScimTypeNoTarget,
+		},
+		{
+			"unknown operation",
+			func() error {
+				return Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{{Op: "move", Path: "userName"}}}.Validate()
+			},
+			ScimTypeInvalidSyntax,
+		},
+		{
+			"unknown attribute",
+			func() error {
+				return ApplyPatch(Patch{Op: Add, Path: "dummy", Value: "foo"}, &Resource{Complex{}}, schema)
+			},
+			ScimTypeInvalidPath,
+		},
+		{
+			"pathless add with non-object value",
+			func() error {
+				return ApplyPatch(Patch{Op: Add, Value: "foo"}, &Resource{Complex{}}, schema)
+			},
+			ScimTypeInvalidValue,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.run()
+			require.NotNil(t, err)
+
+			e := AsError(err)
+			assert.Equal(t, test.scimType, e.ScimType)
+			assert.Equal(t, http.StatusBadRequest, e.Status)
+		})
+	}
+}
+
+// dialect which fails on every value, as a dialect with a bug would
+type panickingDialect struct {
+	Dialect
+}
+
+func (d panickingDialect) CoerceValue(attr *Attribute, value interface{}) interface{} {
+	var m map[string]interface{}
+	m["value"] = value
+	return m
+}
+
+func TestApplyPatchRecover(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	t.Run("errors of nested operations", func(t *testing.T) {
+		err := ApplyPatch(Patch{Op: Add, Value: map[string]interface{}{"nickName": nil}}, &Resource{Complex{}}, schema, StrictCompliance())
+		require.NotNil(t, err)
+		errs, ok := err.(Errors)
+		require.True(t, ok)
+		assert.Equal(t, ScimTypeInvalidValue, errs[0].ScimType)
+	})
+
+	t.Run("runtime error", func(t *testing.T) {
+		err := ApplyPatch(Patch{Op: Replace, Path: "userName", Value: "foo"}, &Resource{Complex{}}, schema, WithDialect(panickingDialect{Strict}))
+		require.NotNil(t, err)
+		e := AsError(err)
+		assert.Equal(t, http.StatusInternalServerError, e.Status)
+		assert.Empty(t, e.ScimType)
+	})
+}
+
+func TestRenderError(t *testing.T) {
+	t.Run("SCIM error", func(t *testing.T) {
+		status, body := RenderError(errInvalidPath("No attribute found for path: %s", "dummy"))
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.JSONEq(t, `{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"],
+			"scimType": "invalidPath",
+			"detail": "No attribute found for path: dummy",
+			"status": "400"
+		}`, string(body))
+	})
+
+	t.Run("no error", func(t *testing.T) {
+		status, body := RenderError(nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Nil(t, body)
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		status, body := RenderError(errors.New("boom"))
+		assert.Equal(t, http.StatusInternalServerError, status)
+		assert.JSONEq(t, `{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"],
+			"detail": "boom",
+			"status": "500"
+		}`, string(body))
+	})
+}
@@ -0,0 +1,18 @@
+package scimpatch
+
+// Apply the patch as ApplyModificationWithInverse does.
+func ApplyPatchWithInverse(patch Patch, subj *Resource, schema *Schema, opts ...PatchOption) (Modification, error) {
+	return ApplyModificationWithInverse(Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{patch}}, subj, schema, opts...)
+}
+
+// Apply all operations of the modification as ApplyModification does, returning the modification which reverses it.
+// The inverse is computed from the state of the resource before and after the modification, so that applying it to the
+// result restores the original content exactly, including the removed elements and the order of the elements.
+// Multivalued attributes whose order cannot be restored element by element are replaced as a whole.
+func ApplyModificationWithInverse(mod Modification, subj *Resource, schema *Schema, opts ...PatchOption) (Modification, error) {
+	before := &Resource{subj.Complex.Clone()}
+	if err := ApplyModification(mod, subj, schema, opts...); err != nil {
+		return Modification{}, err
+	}
+	return diff(subj, before, schema, true), nil
+}
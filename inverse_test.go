@@ -0,0 +1,152 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApplyModificationWithInverse(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	require.Nil(t, err)
+
+	groupSchema := &Schema{}
+	err = json.Unmarshal([]byte(GroupSchemaJson), &groupSchema)
+	require.Nil(t, err)
+
+	const userJson = `
+		{
+			"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+			"id": "2819c223-7f76-453a-919d-413861904646",
+			"userName": "david",
+			"nickName": "dave",
+			"name": {"givenName": "David", "familyName": "Q"},
+			"emails": [
+				{"value": "david@example.com", "type": "work", "primary": true},
+				{"value": "david@home.com", "type": "home"},
+				{"value": "david@other.com", "type": "other"}
+			]
+		}
+	`
+	const groupJson = `
+		{
+			"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+			"id": "e9e30dba-f08f-4109-8486-d5c6a331660a",
+			"displayName": "Tour Guides",
+			"members": [
+				{ "value": "first_member_id" },
+				{ "value": "second_member_id" }
+			]
+		}
+	`
+
+	for _, test := range []struct {
+		name      string
+		schema    *Schema
+		data      string
+		ops       []Patch
+		assertion func(inverse Modification)
+	}{
+		{
+			"simple attributes",
+			userSchema,
+			userJson,
+			[]Patch{
+				{Op: Replace, Path: "userName", Value: "foo"},
+				{Op: Remove, Path: "nickName"},
+				{Op: Add, Path: "displayName", Value: "David Q"},
+				{Op: Replace, Path: "name.givenName", Value: "Dave"},
+			},
+			func(inverse Modification) {
+				assert.Equal(t, 4, len(inverse.Ops))
+			},
+		},
+		{
+			"remove element in the middle",
+			userSchema,
+			userJson,
+			[]Patch{{Op: Remove, Path: "emails[type eq \"home\"]"}},
+			func(inverse Modification) {
+				require.Equal(t, 1, len(inverse.Ops))
+				assert.Equal(t, Replace, inverse.Ops[0].Op)
+				assert.Equal(t, "emails", inverse.Ops[0].Path)
+			},
+		},
+		{
+			"remove element at the end",
+			userSchema,
+			userJson,
+			[]Patch{{Op: Remove, Path: "emails[type eq \"other\"]"}},
+			func(inverse Modification) {
+				require.Equal(t, 1, len(inverse.Ops))
+				assert.Equal(t, Add, inverse.Ops[0].Op)
+				assert.Equal(t, "emails", inverse.Ops[0].Path)
+			},
+		},
+		{
+			"move primary flag",
+			userSchema,
+			userJson,
+			[]Patch{{Op: Replace, Path: "emails[type eq \"home\"].primary", Value: true}},
+			func(inverse Modification) {
+				require.Equal(t, 1, len(inverse.Ops))
+				assert.Equal(t, Replace, inverse.Ops[0].Op)
+				assert.Equal(t, "emails", inverse.Ops[0].Path)
+			},
+		},
+		{
+			"add member",
+			groupSchema,
+			groupJson,
+			[]Patch{{Op: Add, Path: "members", Value: []interface{}{map[string]interface{}{"value": "added_member_id"}}}},
+			func(inverse Modification) {
+				assert.Equal(t, []Patch{{Op: Remove, Path: "members[value eq \"added_member_id\"]"}}, inverse.Ops)
+			},
+		},
+		{
+			"remove all members",
+			groupSchema,
+			groupJson,
+			[]Patch{{Op: Remove, Path: "members"}},
+			func(inverse Modification) {
+				require.Equal(t, 1, len(inverse.Ops))
+				assert.Equal(t, Add, inverse.Ops[0].Op)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data := make(map[string]interface{})
+			require.Nil(t, json.Unmarshal([]byte(test.data), &data))
+			original := Complex(data).Clone()
+			resource := &Resource{Complex(data)}
+
+			inverse, err := ApplyModificationWithInverse(Modification{Schemas: []string{PatchOpUrn}, Ops: test.ops}, resource, test.schema)
+			require.Nil(t, err)
+			assert.NotEqual(t, original, resource.GetData())
+			test.assertion(inverse)
+
+			require.Nil(t, ApplyModification(inverse, resource, test.schema))
+			assert.Equal(t, original, resource.GetData())
+		})
+	}
+}
+
+func TestApplyPatchWithInverse(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	resource := &Resource{Complex{"userName": "david"}}
+	inverse, err := ApplyPatchWithInverse(Patch{Op: Replace, Path: "userName", Value: "foo"}, resource, schema)
+	require.Nil(t, err)
+	assert.Equal(t, "foo", resource.GetData()["userName"])
+	assert.Equal(t, Modification{
+		Schemas: []string{PatchOpUrn},
+		Ops:     []Patch{{Op: Replace, Path: "userName", Value: "david"}},
+	}, inverse)
+
+	_, err = ApplyPatchWithInverse(Patch{Op: Replace, Path: "id", Value: "foo"}, resource, schema)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,299 @@
+package scimpatch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operations of RFC 6902 JSON Patch, in addition to add, remove and replace
+const (
+	Move = "move"
+	Copy = "copy"
+	Test = "test"
+)
+
+// Operation of RFC 6902 JSON Patch, whose paths are RFC 6901 JSON Pointers
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// Translate the modification into JSON Patch operations on the resource, which is left untouched.
+// Filter paths are resolved to the indexes of the matching elements, i.e. 'members[value eq "x"]' becomes '/members/1'.
+// Each operation is applied in turn to a copy of the resource, so that the indexes account for the preceding operations,
+// and side effects such as the primary flag moving away from the other elements are translated as well.
+func ToJSONPatch(mod Modification, subj *Resource, schema *Schema, opts ...PatchOption) ([]JSONPatchOperation, error) {
+	working := &Resource{subj.Complex.Clone()}
+	if working.Complex == nil {
+		working.Complex = Complex{}
+	}
+
+	options := newPatchOptions(opts)
+	ops := make([]JSONPatchOperation, 0)
+	for _, patch := range mod.Ops {
+		before := working.Complex.Clone()
+		if err := applyPatch(patch, working, schema, options); err != nil {
+			return nil, err
+		}
+		ops = append(ops, jsonDiff("", map[string]interface{}(before), map[string]interface{}(working.Complex))...)
+	}
+	return ops, nil
+}
+
+// JSON Patch operations which transform x into y
+func jsonDiff(pointer string, x, y interface{}) []JSONPatchOperation {
+	switch x0 := x.(type) {
+	case map[string]interface{}:
+		if y0, ok := y.(map[string]interface{}); ok {
+			return jsonDiffObject(pointer, x0, y0)
+		}
+	case []interface{}:
+		if y0, ok := y.([]interface{}); ok {
+			return jsonDiffArray(pointer, x0, y0)
+		}
+	}
+
+	if identical(x, y) {
+		return nil
+	}
+	return []JSONPatchOperation{{Op: Replace, Path: pointer, Value: deepCopy(y)}}
+}
+
+func jsonDiffObject(pointer string, x, y map[string]interface{}) []JSONPatchOperation {
+	keys := make([]string, 0, len(x)+len(y))
+	for k := range x {
+		keys = append(keys, k)
+	}
+	for k := range y {
+		if _, ok := x[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	ops := make([]JSONPatchOperation, 0)
+	for _, k := range keys {
+		p := pointer + "/" + pointerEscaper.Replace(k)
+		switch {
+		case x[k] == nil && y[k] == nil:
+		case y[k] == nil:
+			ops = append(ops, JSONPatchOperation{Op: Remove, Path: p})
+		case x[k] == nil:
+			ops = append(ops, JSONPatchOperation{Op: Add, Path: p, Value: deepCopy(y[k])})
+		default:
+			ops = append(ops, jsonDiff(p, x[k], y[k])...)
+		}
+	}
+	return ops
+}
+
+// Elements removed from the array are removed by their index, starting from the last one so that the preceding indexes
+// stay valid. Otherwise the elements are compared one by one, and the extra elements are appended or removed at the end.
+func jsonDiffArray(pointer string, x, y []interface{}) []JSONPatchOperation {
+	ops := make([]JSONPatchOperation, 0)
+	if len(y) < len(x) {
+		removed, j := make([]int, 0), 0
+		for i := range x {
+			if j < len(y) && identical(x[i], y[j]) {
+				j++
+			} else {
+				removed = append(removed, i)
+			}
+		}
+		if j == len(y) {
+			for i := len(removed) - 1; i >= 0; i-- {
+				ops = append(ops, JSONPatchOperation{Op: Remove, Path: pointer + "/" + strconv.Itoa(removed[i])})
+			}
+			return ops
+		}
+	}
+
+	for i := 0; i < len(x) && i < len(y); i++ {
+		ops = append(ops, jsonDiff(pointer+"/"+strconv.Itoa(i), x[i], y[i])...)
+	}
+	for i := len(x); i < len(y); i++ {
+		ops = append(ops, JSONPatchOperation{Op: Add, Path: pointer + "/-", Value: deepCopy(y[i])})
+	}
+	for i := len(x) - 1; i >= len(y); i-- {
+		ops = append(ops, JSONPatchOperation{Op: Remove, Path: pointer + "/" + strconv.Itoa(i)})
+	}
+	return ops
+}
+
+// Translate the JSON Patch operations on the resource into a modification, leaving the resource untouched.
+// Pointers to elements of multivalued complex attributes are translated into filter paths built from Assist.ArrayIndexKey,
+// i.e. '/emails/1/value' becomes 'emails[value eq "x"].value', and fail with invalidPath when the element cannot be singled
+// out that way. Elements can only be appended, as SCIM has no notion of the position of elements.
+// Move and copy are translated into remove and add, and test is evaluated against the resource instead of being translated.
+func FromJSONPatch(ops []JSONPatchOperation, subj *Resource, schema *Schema) (Modification, error) {
+	working := &Resource{subj.Complex.Clone()}
+	if working.Complex == nil {
+		working.Complex = Complex{}
+	}
+
+	translated := make([]Patch, 0)
+	queue := make([]JSONPatchOperation, 0, 2)
+	for _, op := range ops {
+		switch strings.ToLower(op.Op) {
+		case Move, Copy:
+			from, err := resolvePointer(op.From, working, schema)
+			if err != nil {
+				return Modification{}, err
+			}
+			if !from.exists {
+				return Modification{}, errNoTarget("No value found at pointer: %s", op.From)
+			}
+			if strings.ToLower(op.Op) == Move {
+				queue = append(queue, JSONPatchOperation{Op: Remove, Path: op.From})
+			}
+			queue = append(queue, JSONPatchOperation{Op: Add, Path: op.Path, Value: deepCopy(from.value)})
+		default:
+			queue = append(queue, op)
+		}
+
+		for ; len(queue) > 0; queue = queue[1:] {
+			patches, err := fromJSONPatchOperation(queue[0], working, schema)
+			if err != nil {
+				return Modification{}, err
+			}
+			for _, patch := range patches {
+				if err := ApplyPatch(patch, working, schema); err != nil {
+					return Modification{}, err
+				}
+			}
+			translated = append(translated, patches...)
+		}
+	}
+	return Modification{Schemas: []string{PatchOpUrn}, Ops: translated}, nil
+}
+
+func fromJSONPatchOperation(op JSONPatchOperation, subj *Resource, schema *Schema) ([]Patch, error) {
+	target, err := resolvePointer(op.Path, subj, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(op.Op) {
+	case Add:
+		switch {
+		case target.appends:
+			return []Patch{{Op: Add, Path: target.basePath, Value: []interface{}{op.Value}}}, nil
+		case target.index >= 0:
+			return nil, errInvalidPath("Elements can only be appended: %s", op.Path)
+		}
+		return target.set(op.Value), nil
+
+	case Replace:
+		if !target.exists {
+			return nil, errNoTarget("No value found at pointer: %s", op.Path)
+		}
+		if target.index >= 0 {
+			if covers(op.Value, target.value) {
+				return []Patch{{Op: Replace, Path: target.path, Value: op.Value}}, nil
+			}
+			return []Patch{
+				{Op: Remove, Path: target.path},
+				{Op: Add, Path: target.basePath, Value: []interface{}{op.Value}},
+			}, nil
+		}
+		return target.set(op.Value), nil
+
+	case Remove:
+		if !target.exists {
+			return nil, errNoTarget("No value found at pointer: %s", op.Path)
+		}
+		return []Patch{{Op: Remove, Path: target.path}}, nil
+
+	case Test:
+		if !target.exists || !identical(target.value, op.Value) {
+			return nil, errInvalidValue("Test failed at pointer: %s", op.Path)
+		}
+		return nil, nil
+
+	default:
+		return nil, errInvalidSyntax("Invalid operator: %s", op.Op)
+	}
+}
+
+// location in the resource designated by a JSON Pointer
+type pointerTarget struct {
+	path     string     // SCIM path to the location
+	attr     *Attribute // attribute at the location
+	value    interface{}
+	exists   bool
+	index    int    // index of the element designated by the pointer, -1 if the pointer does not end at an element
+	appends  bool   // whether the pointer designates the end of the multivalued, i.e. '/emails/-'
+	basePath string // SCIM path to the multivalued, when the pointer ends at an element
+}
+
+// operations setting the value at the location, as add and replace of JSON Patch do
+func (t *pointerTarget) set(value interface{}) []Patch {
+	if t.exists && t.attr.ExpectsComplex() {
+		return []Patch{{Op: Remove, Path: t.path}, {Op: Add, Path: t.path, Value: value}}
+	}
+	return []Patch{{Op: Replace, Path: t.path, Value: value}}
+}
+
+func resolvePointer(pointer string, subj *Resource, schema *Schema) (*pointerTarget, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errInvalidPath("Invalid pointer: %s", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	target := &pointerTarget{index: -1, exists: true, value: map[string]interface{}(subj.Complex)}
+	var (
+		guide AttributeSource = schema
+		mv    MultiValued
+	)
+	for i, tok := range tokens {
+		tok = pointerUnescaper.Replace(tok)
+		if mv != nil {
+			last := i == len(tokens)-1
+			if tok == "-" && last {
+				target.appends, target.basePath, target.exists, target.value = true, target.path, false, nil
+				return target, nil
+			}
+			index, err := strconv.Atoi(tok)
+			if err != nil || index < 0 || index > len(mv) || (index == len(mv) && !last) {
+				return nil, errInvalidPath("Invalid index in pointer: %s", pointer)
+			}
+			if index == len(mv) {
+				target.appends, target.basePath, target.exists, target.value = true, target.path, false, nil
+				return target, nil
+			}
+			filterPath, _, ok := elementFilter(target.path, target.attr, mv, index)
+			if !ok {
+				return nil, errInvalidPath("Element cannot be identified by a filter: %s", pointer)
+			}
+			target.basePath, target.path, target.index, target.value = target.path, filterPath, index, mv.Get(index)
+			mv = nil
+			continue
+		}
+
+		attr := guide.GetAttribute(attributePath(tok), false)
+		if attr == nil {
+			return nil, errInvalidPath("No attribute found for pointer: %s", pointer)
+		}
+		target.path = subPathPrefix(target.path, target.attr) + attr.Name
+
+		m, _ := target.value.(map[string]interface{})
+		target.attr, target.index, target.basePath = attr, -1, ""
+		target.value = lookup(m, attr.Name)
+		target.exists = target.value != nil
+		if arr, ok := target.value.([]interface{}); ok && attr.MultiValued {
+			mv = MultiValued(arr)
+		} else if attr.MultiValued {
+			mv = MultiValued{}
+		}
+		guide = attr
+	}
+	return target, nil
+}
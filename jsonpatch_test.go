@@ -0,0 +1,230 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newJSONPatchTestUser() *Resource {
+	return &Resource{Complex{
+		"userName": "david",
+		"name":     map[string]interface{}{"givenName": "David", "familyName": "Q"},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "david@example.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "david@home.com", "type": "home"},
+			map[string]interface{}{"value": "david@other.com", "type": "other"},
+		},
+	}}
+}
+
+func TestToJSONPatch(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		ops       []Patch
+		assertion func(ops []JSONPatchOperation, err error)
+	}{
+		{
+			"simple attributes",
+			[]Patch{
+				{Op: Replace, Path: "userName", Value: "foo"},
+				{Op: Add, Path: "nickName", Value: "dave"},
+				{Op: Remove, Path: "name.familyName"},
+			},
+			func(ops []JSONPatchOperation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []JSONPatchOperation{
+					{Op: Replace, Path: "/userName", Value: "foo"},
+					{Op: Add, Path: "/nickName", Value: "dave"},
+					{Op: Remove, Path: "/name/familyName"},
+				}, ops)
+			},
+		},
+		{
+			"filter resolved to index",
+			[]Patch{
+				{Op: Replace, Path: "emails[type eq \"home\"].value", Value: "foo@home.com"},
+				{Op: Remove, Path: "emails[type eq \"work\"]"},
+				{Op: Remove, Path: "emails[type eq \"other\"]"},
+			},
+			func(ops []JSONPatchOperation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []JSONPatchOperation{
+					{Op: Replace, Path: "/emails/1/value", Value: "foo@home.com"},
+					{Op: Remove, Path: "/emails/0"},
+					{Op: Remove, Path: "/emails/1"},
+				}, ops)
+			},
+		},
+		{
+			"add primary element",
+			[]Patch{
+				{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "foo@bar.com", "primary": true}},
+			},
+			func(ops []JSONPatchOperation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []JSONPatchOperation{
+					{Op: Replace, Path: "/emails/0/primary", Value: false},
+					{Op: Add, Path: "/emails/-", Value: map[string]interface{}{"value": "foo@bar.com", "primary": true}},
+				}, ops)
+			},
+		},
+		{
+			"invalid path",
+			[]Patch{{Op: Replace, Path: "unknown", Value: "foo"}},
+			func(ops []JSONPatchOperation, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidPath, err.(*Error).ScimType)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := newJSONPatchTestUser()
+			ops, err := ToJSONPatch(Modification{Schemas: []string{PatchOpUrn}, Ops: test.ops}, resource, schema)
+			test.assertion(ops, err)
+			assert.Equal(t, newJSONPatchTestUser(), resource)
+		})
+	}
+}
+
+func TestFromJSONPatch(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		ops       []JSONPatchOperation
+		assertion func(mod Modification, err error)
+	}{
+		{
+			"simple attributes",
+			[]JSONPatchOperation{
+				{Op: Replace, Path: "/USERNAME", Value: "foo"},
+				{Op: Add, Path: "/nickName", Value: "dave"},
+				{Op: Remove, Path: "/name/familyName"},
+			},
+			func(mod Modification, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []Patch{
+					{Op: Replace, Path: "userName", Value: "foo"},
+					{Op: Replace, Path: "nickName", Value: "dave"},
+					{Op: Remove, Path: "name.familyName"},
+				}, mod.Ops)
+			},
+		},
+		{
+			"index resolved to filter",
+			[]JSONPatchOperation{
+				{Op: Replace, Path: "/emails/1/value", Value: "foo@home.com"},
+				{Op: Remove, Path: "/emails/0"},
+				{Op: Remove, Path: "/emails/0/type"},
+			},
+			func(mod Modification, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []Patch{
+					{Op: Replace, Path: "emails[value eq \"david@home.com\"].value", Value: "foo@home.com"},
+					{Op: Remove, Path: "emails[value eq \"david@example.com\"]"},
+					{Op: Remove, Path: "emails[value eq \"foo@home.com\"].type"},
+				}, mod.Ops)
+			},
+		},
+		{
+			"append and replace elements",
+			[]JSONPatchOperation{
+				{Op: Add, Path: "/emails/-", Value: map[string]interface{}{"value": "foo@bar.com"}},
+				{Op: Replace, Path: "/emails/1", Value: map[string]interface{}{"value": "david@home.com", "type": "work"}},
+				{Op: Replace, Path: "/emails/2", Value: map[string]interface{}{"value": "david@other.com"}},
+			},
+			func(mod Modification, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []Patch{
+					{Op: Add, Path: "emails", Value: []interface{}{map[string]interface{}{"value": "foo@bar.com"}}},
+					{Op: Replace, Path: "emails[value eq \"david@home.com\"]", Value: map[string]interface{}{"value": "david@home.com", "type": "work"}},
+					{Op: Remove, Path: "emails[value eq \"david@other.com\"]"},
+					{Op: Add, Path: "emails", Value: []interface{}{map[string]interface{}{"value": "david@other.com"}}},
+				}, mod.Ops)
+			},
+		},
+		{
+			"move and test",
+			[]JSONPatchOperation{
+				{Op: Test, Path: "/name/givenName", Value: "David"},
+				{Op: Move, From: "/name/givenName", Path: "/nickName"},
+			},
+			func(mod Modification, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []Patch{
+					{Op: Remove, Path: "name.givenName"},
+					{Op: Replace, Path: "nickName", Value: "David"},
+				}, mod.Ops)
+			},
+		},
+		{
+			"failed test",
+			[]JSONPatchOperation{{Op: Test, Path: "/userName", Value: "foo"}},
+			func(mod Modification, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			},
+		},
+		{
+			"insertion",
+			[]JSONPatchOperation{{Op: Add, Path: "/emails/0", Value: map[string]interface{}{"value": "foo@bar.com"}}},
+			func(mod Modification, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidPath, err.(*Error).ScimType)
+			},
+		},
+		{
+			"missing target",
+			[]JSONPatchOperation{{Op: Remove, Path: "/nickName"}},
+			func(mod Modification, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeNoTarget, err.(*Error).ScimType)
+			},
+		},
+		{
+			"unknown attribute",
+			[]JSONPatchOperation{{Op: Add, Path: "/unknown", Value: "foo"}},
+			func(mod Modification, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidPath, err.(*Error).ScimType)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := newJSONPatchTestUser()
+			mod, err := FromJSONPatch(test.ops, resource, schema)
+			test.assertion(mod, err)
+			assert.Equal(t, newJSONPatchTestUser(), resource)
+		})
+	}
+}
+
+func TestJSONPatchRoundTrip(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	mod := Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+		{Op: Replace, Path: "emails[type eq \"home\"]", Value: map[string]interface{}{"display": "home"}},
+		{Op: Remove, Path: "emails[type eq \"work\"]"},
+		{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "foo@bar.com", "type": "work"}},
+	}}
+
+	ops, err := ToJSONPatch(mod, newJSONPatchTestUser(), schema)
+	require.Nil(t, err)
+	translated, err := FromJSONPatch(ops, newJSONPatchTestUser(), schema)
+	require.Nil(t, err)
+
+	expected, actual := newJSONPatchTestUser(), newJSONPatchTestUser()
+	require.Nil(t, ApplyModification(mod, expected, schema))
+	require.Nil(t, ApplyModification(translated, actual, schema))
+	assert.Equal(t, expected, actual)
+}
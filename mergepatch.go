@@ -0,0 +1,69 @@
+package scimpatch
+
+import (
+	"reflect"
+)
+
+// Apply the RFC 7396 JSON Merge Patch to the resource.
+// Attribute names are resolved against the schema ignoring the case, as Path.CorrectCase does. Null removes the attribute,
+// an object is merged into the complex attribute, and any other value, including arrays for multivalued attributes,
+// replaces the attribute as a whole. The merge patch is translated into patch operations, which are applied as
+// ApplyModification does, so the same validation and mutability checks apply and the resource stays untouched on failure.
+func ApplyMergePatch(patch map[string]interface{}, subj *Resource, schema *Schema, opts ...PatchOption) error {
+	ops, err := mergePatchOps("", schema, patch, subj.Complex)
+	if err != nil {
+		return err
+	}
+	return ApplyModification(Modification{Schemas: []string{PatchOpUrn}, Ops: ops}, subj, schema, opts...)
+}
+
+// translate the merge patch of the complex value into patch operations
+func mergePatchOps(prefix string, guide AttributeSource, patch map[string]interface{}, target map[string]interface{}) ([]Patch, error) {
+	ops := make([]Patch, 0)
+	for _, k := range sortedKeys(patch) {
+		kp, attr := keyPath(k, guide)
+		if attr == nil {
+			return nil, errInvalidPath("No attribute found for path: %s", prefix+k)
+		}
+		p := prefix + kp.CollectValue()
+		current := interface{}(target)
+		for seg := kp; seg != nil; seg = seg.Next() {
+			m, _ := current.(map[string]interface{})
+			current = lookup(m, seg.Base())
+		}
+
+		v := patch[k]
+		m, isObject := v.(map[string]interface{})
+		switch {
+		case v == nil:
+			ops = append(ops, Patch{Op: Remove, Path: p})
+		case isObject && attr.ExpectsComplex() && attr.Assigned(reflect.ValueOf(current)):
+			currentMap, _ := current.(map[string]interface{})
+			subOps, err := mergePatchOps(subPathPrefix(p, attr), attr, m, currentMap)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, subOps...)
+		case isObject:
+			ops = append(ops, Patch{Op: Replace, Path: p, Value: withoutNulls(m)})
+		default:
+			ops = append(ops, Patch{Op: Replace, Path: p, Value: v})
+		}
+	}
+	return ops, nil
+}
+
+// copy of the object with the null members removed, as they are not to be created by a merge patch
+func withoutNulls(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch v0 := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			result[k] = withoutNulls(v0)
+		default:
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,149 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		patch     string
+		opts      []PatchOption
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"simple attributes",
+			`{"UserName": "foo", "nickName": null, "displayName": "David"}`,
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", r.GetData()["userName"])
+				assert.Equal(t, "David", r.GetData()["displayName"])
+				_, ok := r.GetData()["nickName"]
+				assert.False(t, ok)
+			},
+		},
+		{
+			"complex attribute is merged",
+			`{"name": {"givenName": "Dave", "middleName": null}}`,
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "Dave", "familyName": "Q"}, r.GetData()["name"])
+			},
+		},
+		{
+			"unassigned complex attribute is created",
+			`{"name": null}`,
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				require.Nil(t, ApplyMergePatch(map[string]interface{}{
+					"name": map[string]interface{}{"givenName": "Dave", "middleName": nil},
+				}, r, schema))
+				assert.Equal(t, map[string]interface{}{"givenName": "Dave"}, r.GetData()["name"])
+			},
+		},
+		{
+			"attribute qualified by schema",
+			`{"urn:ietf:params:scim:schemas:core:2.0:User:Name": {"GivenName": "Dave"}}`,
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "Dave", "familyName": "Q", "middleName": "X"}, r.GetData()["name"])
+			},
+		},
+		{
+			"multivalued attribute is replaced",
+			`{"emails": [{"value": "foo@bar.com", "type": "work"}]}`,
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "foo@bar.com", "type": "work"},
+				}, r.GetData()["emails"])
+			},
+		},
+		{
+			"unknown attribute",
+			`{"userName": "foo", "unknown": "bar"}`,
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidPath, err.(*Error).ScimType)
+				assert.Equal(t, "david", r.GetData()["userName"])
+			},
+		},
+		{
+			"read only attribute",
+			`{"userName": "foo", "id": "bar"}`,
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeMutability, err.(*Error).ScimType)
+				assert.Equal(t, "david", r.GetData()["userName"])
+			},
+		},
+		{
+			"read only attribute ignored",
+			`{"userName": "foo", "id": "bar"}`,
+			[]PatchOption{IgnoreReadOnlyWrites()},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", r.GetData()["userName"])
+				assert.Equal(t, "2819c223-7f76-453a-919d-413861904646", r.GetData()["id"])
+			},
+		},
+		{
+			"invalid value",
+			`{"active": "yes"}`,
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{
+				"id":       "2819c223-7f76-453a-919d-413861904646",
+				"userName": "david",
+				"nickName": "dave",
+				"name":     map[string]interface{}{"givenName": "David", "familyName": "Q", "middleName": "X"},
+				"emails": []interface{}{
+					map[string]interface{}{"value": "david@example.com", "type": "work", "primary": true},
+				},
+			}}
+
+			patch := make(map[string]interface{})
+			require.Nil(t, json.Unmarshal([]byte(test.patch), &patch))
+			err := ApplyMergePatch(patch, resource, schema, test.opts...)
+			test.assertion(resource, err)
+		})
+	}
+}
+
+func TestApplyMergePatchMembers(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(GroupSchemaJson), &schema)
+	require.Nil(t, err)
+
+	resource := &Resource{Complex{
+		"displayName": "Tour Guides",
+		"members": []interface{}{
+			map[string]interface{}{"value": "first_member_id"},
+		},
+	}}
+	err = ApplyMergePatch(map[string]interface{}{
+		"members": []interface{}{map[string]interface{}{"value": "second_member_id"}},
+	}, resource, schema)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"value": "second_member_id"}}, resource.GetData()["members"])
+}
@@ -0,0 +1,114 @@
+package scimpatch
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Enforce the mutability of the attributes written by the patch, see RFC 7643 section 7.
+// Read only attributes can never be written, and immutable attributes can only be written while they are unassigned.
+// Returns the value to write, which has read only sub attributes stripped when they are ignored, and false if the whole
+// patch is to be skipped.
+func (ps *patchState) enforceMutability(p Path, v reflect.Value, subj *Resource) (reflect.Value, bool) {
+	var guide AttributeSource = ps.sch
+	for c := p; c != nil; c = c.Next() {
+		attr := guide.GetAttribute(c, false)
+		if attr == nil {
+			break
+		}
+		if attr.Mutability == ReadOnly {
+			if ps.opts.ignoreReadOnly {
+				return v, false
+			}
+			ps.throw(errMutability("Attribute is read only: %s", ps.pathText))
+		}
+		guide = attr
+	}
+
+	if ps.destAttr.Mutability == Immutable {
+		assigned := false
+		for existing := range subj.Get(p, ps.sch) {
+			if ps.destAttr.Assigned(reflect.ValueOf(existing)) {
+				assigned = true
+			}
+		}
+		if assigned {
+			ps.throw(errMutability("Attribute is immutable and already assigned: %s", ps.pathText))
+		}
+	}
+
+	if !v.IsValid() || ps.destAttr.Type != TypeComplex {
+		return v, true
+	}
+
+	if strings.ToLower(ps.patch.Op) != Remove {
+		existing := make([]interface{}, 0)
+		for value := range subj.Get(p, ps.sch) {
+			existing = append(existing, value)
+		}
+		for _, value := range existing {
+			ps.enforceImmutable(value, v.Interface())
+		}
+	}
+
+	stripped := reflect.ValueOf(ps.stripReadOnly(ps.destAttr, copyOfValue(v)))
+	return stripped, true
+}
+
+// Reject the complex value which changes the immutable sub attributes already assigned in the complex value or the
+// element it is merged into. A multivalued replaced as a whole is not subject to this, as its elements do not stay.
+func (ps *patchState) enforceImmutable(existing, value interface{}) {
+	orig, ok := existing.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		ps.enforceImmutableMerge(ps.destAttr.elementAttribute(), orig, m)
+	}
+}
+
+// reject the complex value changing the immutable sub attributes assigned in the complex value it is merged into
+func (ps *patchState) enforceImmutableMerge(attr *Attribute, orig, value map[string]interface{}) {
+	for k, v := range value {
+		subAttr := attr.SubAttribute(k)
+		if subAttr == nil {
+			continue
+		}
+		o := lookup(orig, subAttr.Name)
+		switch {
+		case subAttr.Mutability == Immutable && subAttr.Assigned(reflect.ValueOf(o)) && !subAttr.valueEquals(o, v):
+			ps.throw(errMutability("Attribute is immutable and already assigned: %s", subAttr.Assist.FullPath))
+		case subAttr.ExpectsComplex():
+			om, _ := o.(map[string]interface{})
+			if vm, ok := v.(map[string]interface{}); ok && om != nil {
+				ps.enforceImmutableMerge(subAttr, om, vm)
+			}
+		}
+	}
+}
+
+// look for read only sub attributes in the complex value, which are removed if they are ignored
+func (ps *patchState) stripReadOnly(attr *Attribute, value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = ps.stripReadOnly(attr, elem)
+		}
+	case map[string]interface{}:
+		for k, elem := range v {
+			subAttr := attr.SubAttribute(k)
+			if subAttr == nil {
+				continue
+			}
+			if subAttr.Mutability == ReadOnly {
+				if !ps.opts.ignoreReadOnly {
+					ps.throw(errMutability("Attribute is read only: %s", subAttr.Assist.FullPath))
+				}
+				delete(v, k)
+			} else if subAttr.Type == TypeComplex {
+				v[k] = ps.stripReadOnly(subAttr, elem)
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+package scimpatch
+
+// Option to customize how a patch is applied
+type PatchOption func(*patchOptions)
+
+type patchOptions struct {
+	observer              ChangeObserver // receives the changes made to the resource
+	ignoreReadOnly        bool           // silently skip writes to read only attributes instead of failing
+	rejectMultiplePrimary bool           // fail instead of moving the primary flag away from the existing primary element
+	dialect               Dialect        // dialect of the client which sent the patch
+	strict                bool           // reject payloads which do not comply with RFC 7644
+}
+
+func newPatchOptions(opts []PatchOption) *patchOptions {
+	options := &patchOptions{dialect: AzureAD}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// copy of the options with the observer swapped
+func (o *patchOptions) withObserver(observer ChangeObserver) *patchOptions {
+	o0 := *o
+	o0.observer = observer
+	return &o0
+}
+
+// Report every change made to the resource to the observer
+func WithObserver(observer ChangeObserver) PatchOption {
+	return func(o *patchOptions) {
+		o.observer = observer
+	}
+}
+
+// Silently skip writes to read only attributes instead of failing with a mutability error,
+// as some identity providers send the whole resource including read only attributes.
+func IgnoreReadOnlyWrites() PatchOption {
+	return func(o *patchOptions) {
+		o.ignoreReadOnly = true
+	}
+}
+
+// Fail with an invalidValue error when the patch flags an element as primary while another element of the
+// multivalued is already primary. By default the flag is moved to the new element.
+func RejectMultiplePrimary() PatchOption {
+	return func(o *patchOptions) {
+		o.rejectMultiplePrimary = true
+	}
+}
+
+// Tolerate the deviations of the client from RFC 7644 as the dialect does, instead of the default AzureAD.
+// Use Strict for clients following RFC 7644.
+func WithDialect(d Dialect) PatchOption {
+	return func(o *patchOptions) {
+		if d != nil {
+			o.dialect = d
+		}
+	}
+}
+
+// Reject payloads which do not comply with RFC 7644 instead of tolerating them, reporting every violation at once.
+// The Strict dialect is used, so no deviation of the client is fixed silently.
+func StrictCompliance() PatchOption {
+	return func(o *patchOptions) {
+		o.strict = true
+		o.dialect = Strict
+	}
+}
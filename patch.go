@@ -23,56 +23,101 @@ type Modification struct {
 	Ops     []Patch  `json:"Operations"`
 }
 
-func (m Modification) Validate() error {
-	if len(m.Schemas) != 1 && m.Schemas[0] != PatchOpUrn {
-		return fmt.Errorf("Invalid parameter: %+v", m.Schemas)
+// Apply all operations of the modification as a single unit.
+// Operations are applied in order to a copy of the resource, and the result is committed back to
+// the resource only when every operation succeeded, so the resource stays untouched on any failure.
+// The changes are reported to the observer only after they are committed.
+// Required attributes are enforced once all operations are applied, so that an operation may remove a required
+// attribute which a later operation assigns again.
+func ApplyModification(mod Modification, subj *Resource, schema *Schema, opts ...PatchOption) error {
+	options := newPatchOptions(opts)
+	working, buffer, err := modify(mod, subj, schema, options)
+	if err != nil {
+		return err
 	}
 
-	if len(m.Ops) == 0 {
-		return fmt.Errorf("Invalid parameter: no ops")
+	subj.commit(working.Complex)
+	buffer.flush(options.observer)
+	return nil
+}
+
+// apply all operations of the modification in order to a copy of the resource, and enforce the required attributes
+// once they are all applied. The copy is returned along with the changes made to it, the resource is left untouched.
+// The whole modification is validated up front in strict compliance.
+func modify(mod Modification, subj *Resource, schema *Schema, options *patchOptions) (*Resource, *changeBuffer, error) {
+	if options.strict {
+		if err := mod.violations(schema, options).orNil(); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	for _, patch := range m.Ops {
-		switch strings.ToLower(patch.Op) {
-		case Add:
-			if patch.Value == nil {
-				return fmt.Errorf("Invalid parameter: value is not present")
-			} else if len(patch.Path) == 0 {
-				if _, ok := patch.Value.(map[string]interface{}); !ok {
-					return fmt.Errorf("Invalid parameter: path is not present")
-				}
-			}
-		case Replace:
-			if patch.Value == nil {
-				return fmt.Errorf("Invalid parameter: value is not present")
-			} else if len(patch.Path) == 0 {
-				return fmt.Errorf("Invalid parameter: path is not present")
-			}
-		case Remove:
-			if len(patch.Path) == 0 {
-				return fmt.Errorf("Invalid parameter: path is not present")
-			}
+	working := &Resource{subj.Complex.Clone()}
+	if working.Complex == nil {
+		working.Complex = Complex{}
+	}
 
-		default:
-			return fmt.Errorf("Invalid operation: must be one of [add|remove|replace]")
+	buffer := &changeBuffer{changes: make([]Change, 0)}
+	workingOptions := options.withObserver(buffer)
+	required := newRequiredCheck(subj.Complex, schema)
+	for _, patch := range mod.Ops {
+		if err := applyPatch(patch, working, schema, workingOptions); err != nil {
+			return nil, nil, err
 		}
 	}
+	if err := required.enforce(working.Complex); err != nil {
+		return nil, nil, err
+	}
+	return working, buffer, nil
+}
 
-	return nil
+// Apply the patch operation to the resource in place. Unlike ApplyModification, the resource is left as the operation
+// has modified it so far on failure. When the operation leaves a required attribute unassigned, though, the resource
+// is restored, and the changes are not reported to the observer.
+func ApplyPatch(patch Patch, subj *Resource, schema *Schema, opts ...PatchOption) error {
+	options := newPatchOptions(opts)
+	before := subj.Complex.Clone()
+	required := newRequiredCheck(subj.Complex, schema)
+	buffer := &changeBuffer{}
+	err := applyPatch(patch, subj, schema, options.withObserver(buffer))
+	if err == nil {
+		if err = required.enforce(subj.Complex); err != nil {
+			subj.commit(before)
+			return err
+		}
+	}
+	buffer.flush(options.observer)
+	return err
 }
 
-func ApplyPatch(patch Patch, subj *Resource, schema *Schema) (err error) {
+func applyPatch(patch Patch, subj *Resource, schema *Schema, opts *patchOptions) (err error) {
+	// errors thrown by the patch state, including those of the nested operations of a pathless one, are returned as
+	// they are, while any other panic is a failure of the engine, reported as AsError does for foreign errors
 	defer func() {
 		if r := recover(); r != nil {
-			switch r.(type) {
+			switch r0 := r.(type) {
+			case *Error:
+				err = r0
+			case Errors:
+				err = r0
 			case error:
-				err = r.(error)
+				err = AsError(r0)
 			default:
-				err = fmt.Errorf("%v", r)
+				err = AsError(fmt.Errorf("%v", r))
 			}
 		}
 	}()
 
+	if opts.strict {
+		if err := patchViolations(patch, nil, opts).orNil(); err != nil {
+			return err
+		}
+	}
+
+	dialect := opts.dialect
+	if patch, err = dialect.PreparePatch(patch); err != nil {
+		return err
+	}
+
 	err, psPtr, pathPtr := buildPatchState(patch, schema)
 	if err != nil {
 		return err
@@ -81,9 +126,23 @@ func ApplyPatch(patch Patch, subj *Resource, schema *Schema) (err error) {
 	ps := *psPtr
 	path := *pathPtr
 
-	err = applyAzureADRemoveSupport(&ps, &path)
-	if err != nil {
-		return err
+	if ps.destAttr != nil {
+		rewritten, err := dialect.RewritePath(patch, ps.destAttr)
+		if err != nil {
+			return err
+		}
+		if rewritten != patch.Path {
+			patch.Path = rewritten
+			if err, psPtr, pathPtr = buildPatchState(patch, schema); err != nil {
+				return err
+			}
+			ps, path = *psPtr, *pathPtr
+		}
+	}
+
+	ps.opts = opts
+	if path != nil {
+		ps.pathText = path.CollectValue()
 	}
 
 	v := reflect.ValueOf(patch.Value)
@@ -91,15 +150,46 @@ func ApplyPatch(patch Patch, subj *Resource, schema *Schema) (err error) {
 		v = v.Elem()
 	}
 
-	switch strings.ToLower(patch.Op) {
+	op := strings.ToLower(patch.Op)
+	switch op {
+	case Add, Replace:
+		if ps.destAttr != nil && v.IsValid() {
+			v = reflect.ValueOf(dialect.CoerceValue(ps.destAttr, v.Interface()))
+		}
+		v = ps.coerceValue(v, acceptsElement(op, path))
+	case Remove:
+	default:
+		return errInvalidSyntax("Invalid operator: %s", patch.Op)
+	}
+
+	var (
+		primaryPath Path
+		primaryAttr *Attribute
+		primaries   map[uintptr]bool
+	)
+	if path != nil {
+		var ok bool
+		if v, ok = ps.enforceMutability(path, v, subj); !ok {
+			return nil
+		}
+		if op != Remove {
+			if primaryPath, primaryAttr = ps.primaryTarget(path); primaryPath != nil {
+				primaries = primaryElements(primaryPath, subj, ps.sch)
+			}
+		}
+	}
+
+	switch op {
 	case Add:
-		ps.applyPatchAdd(path, fixValueWithType(ps.destAttr, v), subj)
+		ps.applyPatchAdd(path, v, subj)
 	case Replace:
-		ps.applyPatchReplace(path, fixValueWithType(ps.destAttr, v), subj)
+		ps.applyPatchReplace(path, v, subj)
 	case Remove:
 		ps.applyPatchRemove(path, subj)
-	default:
-		err = fmt.Errorf("Invalid operator: %s", patch.Op)
+	}
+
+	if primaryPath != nil {
+		ps.enforcePrimary(primaryPath, primaryAttr, primaries, subj)
 	}
 	return
 }
@@ -121,112 +211,103 @@ func buildPatchState(patch Patch, schema *Schema) (error, *patchState, *Path) {
 		if attr := schema.GetAttribute(path, true); attr != nil {
 			ps.destAttr = attr
 		} else {
-			return fmt.Errorf("No attribute found for path: %s", patch.Path), nil, nil
+			return errInvalidPath("No attribute found for path: %s", patch.Path), nil, nil
 		}
 	}
 
 	return nil, &ps, &path
 }
 
-// [AzureAD対策]
-// 忌まわしきAzureADのバグとしてそもそも配列値からの要素削除のリクエストがおかしいというものがあり、ここのコードでその対策をしている
-// RFC上は配列からの要素の削除は `members[value eq "target_member_id"]` のようなフィルタクエリで削除対象を指定するものであるが
-// AzureADはなぜかフィルタクエリを使わず、削除対象の要素をvalueフィールドで指定して削除しようとしてくる。
-// そもそもgo-scimpatchはRFCに沿って作られたものであるため、こういうそもそもRFCに則ってないリクエストを受け付けるような動きにはなっていない。
-// したがって、このようなAzureADの動きに対応するようなグルーコードもどきを仕方なく作ることとなった。
-func applyAzureADRemoveSupport(ps *patchState, path *Path) error {
-	patch := (*ps).patch
-
-	if ps.destAttr != nil {
-		if strings.ToLower(patch.Op) == "remove" && ps.destAttr.MultiValued && patch.Value != nil {
-			v := reflect.ValueOf(patch.Value)
-			if v.Kind() == reflect.Interface {
-				v = v.Elem()
-			}
+type patchState struct {
+	patch    Patch
+	destAttr *Attribute
+	sch      *Schema
+	pathText string        // case corrected text of the path, taken before the path is separated
+	opts     *patchOptions // options of the patch application
+}
 
-			var value reflect.Value
-			switch v.Kind() {
-			case reflect.Map:
-				mapValue := v.Interface().(map[string]interface{})
-				value = reflect.ValueOf(mapValue["value"])
-			case reflect.Slice, reflect.Array:
-				arrayValue := v.Interface().([]interface{})
-				head := arrayValue[0].(map[string]interface{})
-				value = reflect.ValueOf(head["value"])
-			}
+func (ps *patchState) throw(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
 
-			patch.Path = patch.Path + "[value eq \"" + value.String() + "\"]"
-			err, psPtr, pathPtr := buildPatchState(patch, ps.sch)
-			if err != nil {
-				return err
-			}
+// report a change to the observer, if any. Values are copied so that they are not affected by later modifications.
+func (ps *patchState) notify(kind ChangeKind, oldVal, newVal reflect.Value) {
+	ps.notifyAttribute(ps.destAttr, kind, oldVal, newVal)
+}
 
-			*ps = *psPtr
-			*path = *pathPtr
-		}
+// report a change made to an attribute other than the target of the patch
+func (ps *patchState) notifyAttribute(attr *Attribute, kind ChangeKind, oldVal, newVal reflect.Value) {
+	if ps.opts.observer == nil {
+		return
 	}
-
-	return nil
+	ps.opts.observer.ObserveChange(Change{
+		Op:        strings.ToLower(ps.patch.Op),
+		Kind:      kind,
+		Path:      ps.pathText,
+		Attribute: attr.Assist.FullPath,
+		OldValue:  copyOfValue(oldVal),
+		NewValue:  copyOfValue(newVal),
+	})
 }
 
-// [AzureAD対策]
-// 特定のSCIMクライアントがstring型のフィールドに対して配列値を送ってくることがある
-// なので、配列やオブジェクトが値として送られてきた場合にはここで取り出して単一値として与えたい。
-// 雑な実装として配列値が与えられた場合には必ず配列の先頭のオブジェクトから常にvalueフィールドを対象のデータとして取り出すことにする。
-// https://social.msdn.microsoft.com/Forums/lync/en-US/e2200b69-4333-41ea-9f51-717d316c7751/automatic-user-provisioning-scim-restful-patch-payload-issue
-func fixValueWithType(destAttr *Attribute, value reflect.Value) reflect.Value {
-	valueKind := value.Kind()
-
-	// ここでps.destAttrのチェックをしているのはimplicit pathというpathを直接指定せずにデータの追加をするためのテストケースがあるため
-	// 実際にはSCIMのRFCを読んでも規約としては存在していなさそうなので、path指定は必須項目としたいが一旦ここではnilチェックに留めておく。
-	if destAttr != nil {
-		isValueAndTypeUnmatched :=
-			(destAttr.Type == "string" && valueKind != reflect.String) ||
-				(destAttr.Type == "boolean" && valueKind != reflect.Bool)
-
-		if isValueAndTypeUnmatched {
-			var v reflect.Value
-
-			// Mapであればそこからvalueフィールドを取り出す
-			// Slice/Arrayであればその先頭要素のオブジェクトからvalueフィールドを取り出す
-			switch valueKind {
-			case reflect.Map:
-				mapValue := value.Interface().(map[string]interface{})
-				v = reflect.ValueOf(mapValue["value"])
-			case reflect.Slice, reflect.Array:
-				arrayValue := value.Interface().([]interface{})
-				head := arrayValue[0].(map[string]interface{})
-				v = reflect.ValueOf(head["value"])
-			default:
-				v = reflect.ValueOf(value.Interface())
-			}
+// report each element of the multivalued as added or removed
+func (ps *patchState) notifyElements(kind ChangeKind, arr reflect.Value) {
+	if ps.opts.observer == nil || !arr.IsValid() {
+		return
+	}
+	if arr.Kind() == reflect.Interface {
+		arr = arr.Elem()
+	}
 
-			// これもAzureADだがbooleanの値をPascalCaseで送ってくるためパースできない。
-			// なのでもしその文字列がTrue/Falseであればそれをbool値に変換する
-			switch v.Interface().(string) {
-			case "True":
-				v = reflect.ValueOf(true)
-			case "False":
-				v = reflect.ValueOf(false)
+	switch arr.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < arr.Len(); i++ {
+			switch kind {
+			case ElementAdded:
+				ps.notify(kind, reflect.Value{}, arr.Index(i))
+			default:
+				ps.notify(kind, arr.Index(i), reflect.Value{})
 			}
-
-			return v
+		}
+	default:
+		switch kind {
+		case ElementAdded:
+			ps.notify(ValueAssigned, reflect.Value{}, arr)
+		default:
+			ps.notify(ValueRemoved, arr, reflect.Value{})
 		}
 	}
-
-	return value
 }
 
-type patchState struct {
-	patch    Patch
-	destAttr *Attribute
-	sch      *Schema
+// check the value against the type of the target attribute, see Attribute.Coerce
+func (ps *patchState) coerceValue(v reflect.Value, element bool) reflect.Value {
+	if ps.destAttr == nil || !v.IsValid() {
+		return v
+	}
+
+	coerce := ps.destAttr.Coerce
+	if element {
+		coerce = ps.destAttr.CoerceElement
+	}
+	coerced, err := coerce(v.Interface())
+	ps.throw(err)
+	return reflect.ValueOf(coerced)
 }
 
-func (ps *patchState) throw(err error) {
-	if err != nil {
-		panic(err)
+// whether the operation accepts a single element for a multivalued attribute: add appends the element, and a filter
+// selects the elements the element replaces. Otherwise the value replaces the multivalued as a whole.
+func acceptsElement(op string, p Path) bool {
+	if strings.ToLower(op) == Add {
+		return true
 	}
+	for c := p; c != nil; c = c.Next() {
+		if c.Next() == nil {
+			return c.FilterRoot() != nil
+		}
+	}
+	return false
 }
 
 func (ps *patchState) applyPatchRemove(p Path, subj *Resource) {
@@ -241,11 +322,6 @@ func (ps *patchState) applyPatchRemove(p Path, subj *Resource) {
 		baseChannel = subj.Get(basePath, ps.sch)
 	}
 
-	var baseAttr AttributeSource = ps.sch
-	if basePath != nil {
-		baseAttr = ps.sch.GetAttribute(basePath, true)
-	}
-
 	for base := range baseChannel {
 		baseVal := reflect.ValueOf(base)
 		if baseVal.IsNil() {
@@ -260,27 +336,21 @@ func (ps *patchState) applyPatchRemove(p Path, subj *Resource) {
 			keyVal := reflect.ValueOf(lastPath.Base())
 			if ps.destAttr.MultiValued {
 				if lastPath.FilterRoot() == nil {
+					ps.notifyElements(ElementRemoved, baseVal.MapIndex(keyVal))
 					baseVal.SetMapIndex(keyVal, reflect.Value{})
-				} else {
-					origVal := baseVal.MapIndex(keyVal)
-					baseAttr = baseAttr.GetAttribute(lastPath, false)
-					reverseRoot := &filterNode{
-						data: Not,
-						typ:  LogicalOperator,
-						left: lastPath.FilterRoot().(*filterNode),
-					}
-					newElemChannel := MultiValued(origVal.Interface().([]interface{})).Filter(reverseRoot, baseAttr)
-					newArr := make([]interface{}, 0)
-					for newElem := range newElemChannel {
-						newArr = append(newArr, newElem)
-					}
-					if len(newArr) == 0 {
+				} else if orig, ok := multiValuedOf(baseVal.MapIndex(keyVal)); ok {
+					remaining, removed := orig.RemoveByFilter(lastPath.FilterRoot(), ps.destAttr)
+					ps.notifyElements(ElementRemoved, reflect.ValueOf([]interface{}(removed)))
+					if len(remaining) == 0 {
 						baseVal.SetMapIndex(keyVal, reflect.Value{})
 					} else {
-						baseVal.SetMapIndex(keyVal, reflect.ValueOf(newArr))
+						baseVal.SetMapIndex(keyVal, reflect.ValueOf([]interface{}(remaining)))
 					}
 				}
 			} else {
+				if origVal := baseVal.MapIndex(keyVal); origVal.IsValid() {
+					ps.notify(ValueRemoved, origVal, reflect.Value{})
+				}
 				baseVal.SetMapIndex(keyVal, reflect.Value{})
 			}
 		case reflect.Array, reflect.Slice:
@@ -292,19 +362,30 @@ func (ps *patchState) applyPatchRemove(p Path, subj *Resource) {
 				}
 				switch elemVal.Kind() {
 				case reflect.Map:
+					if origVal := elemVal.MapIndex(keyVal); origVal.IsValid() {
+						ps.notify(ValueRemoved, origVal, reflect.Value{})
+					}
 					elemVal.SetMapIndex(keyVal, reflect.Value{})
 				default:
-					ps.throw(fmt.Errorf("Array base contains non-map: %s", ps.patch.Path))
+					ps.throw(errInvalidPath("Array base contains non-map: %s", ps.patch.Path))
 				}
 			}
 		default:
-			ps.throw(fmt.Errorf("Base evaluated to non-map and non-array: %s", ps.patch.Path))
+			ps.throw(errInvalidPath("Base evaluated to non-map and non-array: %s", ps.patch.Path))
 		}
 	}
 }
 
 func (ps *patchState) applyPatchReplace(p Path, v reflect.Value, subj *Resource) {
+	if p == nil {
+		ps.applyPatchPathless(v, subj)
+		return
+	}
+
 	basePath, lastPath := p.SeparateAtLast()
+	if basePath != nil && lastPath.FilterRoot() == nil && v.IsValid() {
+		ps.createBase(basePath, subj)
+	}
 	baseChannel := make(chan interface{}, 1)
 	if basePath == nil {
 		go func() {
@@ -315,6 +396,7 @@ func (ps *patchState) applyPatchReplace(p Path, v reflect.Value, subj *Resource)
 		baseChannel = subj.Get(basePath, ps.sch)
 	}
 
+	matched := 0
 	for base := range baseChannel {
 		baseVal := reflect.ValueOf(base)
 		if baseVal.IsNil() {
@@ -323,23 +405,205 @@ func (ps *patchState) applyPatchReplace(p Path, v reflect.Value, subj *Resource)
 		if baseVal.Kind() == reflect.Interface {
 			baseVal = baseVal.Elem()
 		}
-		baseVal.SetMapIndex(reflect.ValueOf(lastPath.Base()), v)
+		keyVal := reflect.ValueOf(lastPath.Base())
+		if ps.destAttr.MultiValued && lastPath.FilterRoot() != nil {
+			matched += ps.replaceElements(baseVal.MapIndex(keyVal), lastPath.FilterRoot(), v)
+			continue
+		}
+		if ps.destAttr.MultiValued {
+			ps.notifyElements(ElementRemoved, baseVal.MapIndex(keyVal))
+			ps.notifyElements(ElementAdded, v)
+			baseVal.SetMapIndex(keyVal, v)
+		} else {
+			ps.assignValue(baseVal, keyVal, v)
+		}
+	}
+
+	if ps.destAttr.MultiValued && lastPath.FilterRoot() != nil && matched == 0 {
+		ps.throw(errNoTarget("No element matched the filter: %s", ps.pathText))
 	}
 }
 
-func (ps *patchState) applyPatchAdd(p Path, v reflect.Value, subj *Resource) {
-	if p == nil {
-		if v.Kind() != reflect.Map {
-			ps.throw(fmt.Errorf("Invalid parameter for add operation"))
+// Replace the elements of the multivalued which match the filter, see RFC 7644 section 3.5.2.3.
+// Complex values are merged into the matching elements, leaving the sub attributes not mentioned untouched.
+// Returns the number of matching elements.
+func (ps *patchState) replaceElements(arrVal reflect.Value, filter FilterNode, v reflect.Value) int {
+	arr, ok := multiValuedOf(arrVal)
+	if !ok {
+		return 0
+	}
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		ps.throw(errInvalidValue("Invalid parameter: expected a single element for %s", ps.pathText))
+	}
+
+	newElem, merge := v.Interface().(map[string]interface{})
+	indexes := arr.FindIndex(filter, ps.destAttr)
+	for _, i := range indexes {
+		oldElem := reflect.ValueOf(deepCopy(arr.Get(i)))
+		if m, ok := arr.Get(i).(map[string]interface{}); ok && merge {
+			arr.Set(i, mergeComplex(ps.destAttr.elementAttribute(), m, newElem))
+		} else {
+			arr.Set(i, deepCopy(v.Interface()))
 		}
-		for _, k := range v.MapKeys() {
-			v0 := v.MapIndex(k)
-			if err := ApplyPatch(Patch{Op: Add, Path: k.String(), Value: v0.Interface()}, subj, ps.sch); err != nil {
-				ps.throw(err)
+		ps.notify(ElementReplaced, oldElem, reflect.ValueOf(arr.Get(i)))
+	}
+	return len(indexes)
+}
+
+// Assign the single value to the key of the map. A complex value is merged into the complex value already assigned,
+// leaving the sub attributes not mentioned unchanged, see RFC 7644 section 3.5.2.1 and 3.5.2.3.
+func (ps *patchState) assignValue(baseVal, keyVal, v reflect.Value) {
+	orig := baseVal.MapIndex(keyVal)
+	if ps.destAttr.ExpectsComplex() && v.IsValid() {
+		var current interface{}
+		if orig.IsValid() {
+			current = orig.Interface()
+		}
+		v = reflect.ValueOf(mergeComplex(ps.destAttr, current, v.Interface()))
+	}
+	ps.notify(ValueAssigned, orig, v)
+	baseVal.SetMapIndex(keyVal, v)
+}
+
+// Create the single-valued complex values missing on the way to the attribute, such as 'name' for 'name.familyName'
+// or the schema extension for its attributes, so that the attribute is added as RFC 7644 section 3.5.2.1 expects.
+// Multivalued attributes on the way are left as they are, as the element to hold the attribute is not known.
+func (ps *patchState) createBase(basePath Path, subj *Resource) {
+	var guide AttributeSource = ps.sch
+	m := map[string]interface{}(subj.Complex)
+	for c := basePath; c != nil; c = c.Next() {
+		attr := guide.GetAttribute(c, false)
+		if attr == nil || !attr.ExpectsComplex() || c.FilterRoot() != nil {
+			return
+		}
+		v := lookup(m, attr.Name)
+		if v == nil {
+			v = map[string]interface{}{}
+			m[attr.Name] = v
+		}
+		next, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		m, guide = next, attr
+	}
+}
+
+// Merge the complex value into a copy of the complex value assigned, guided by the attribute.
+// Sub attributes are written under the names defined by the schema, and complex sub attributes are merged in turn.
+// Nothing assigned is taken as an empty complex value, so that the sub attributes are written under the names defined
+// by the schema all the same. The value is returned as it is when either is not a complex value.
+func mergeComplex(attr *Attribute, orig interface{}, value interface{}) interface{} {
+	origMap, ok := orig.(map[string]interface{})
+	if !ok && orig != nil {
+		return value
+	}
+	if origMap == nil {
+		origMap = map[string]interface{}{}
+	}
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	merged := deepCopy(origMap).(map[string]interface{})
+	for k, v := range valueMap {
+		subAttr := attr.SubAttribute(k)
+		if subAttr == nil {
+			merged[k] = deepCopy(v)
+			continue
+		}
+
+		current := lookup(merged, subAttr.Name)
+		for existing := range merged {
+			if strings.EqualFold(existing, subAttr.Name) {
+				delete(merged, existing)
 			}
 		}
+		if subAttr.ExpectsComplex() {
+			merged[subAttr.Name] = mergeComplex(subAttr, current, deepCopy(v))
+		} else {
+			merged[subAttr.Name] = deepCopy(v)
+		}
+	}
+	return merged
+}
+
+// get the elements to add from the value, which is either an array of elements or a single element
+func elementsOf(v reflect.Value) []interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Array, reflect.Slice:
+		elems := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, v.Index(i).Interface())
+		}
+		return elems
+	default:
+		return []interface{}{v.Interface()}
+	}
+}
+
+// get the multivalued held by the value, if any
+func multiValuedOf(v reflect.Value) (MultiValued, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+	switch arr := v.Interface().(type) {
+	case []interface{}:
+		return MultiValued(arr), true
+	case MultiValued:
+		return arr, true
+	default:
+		return nil, false
+	}
+}
+
+// Apply the add or replace without a path, whose value holds the attributes to write to the resource itself,
+// see RFC 7644 section 3.5.2.1 and 3.5.2.3. Each attribute is written by the same operation with the attribute as its path.
+func (ps *patchState) applyPatchPathless(v reflect.Value, subj *Resource) {
+	var value interface{}
+	if v.IsValid() {
+		value = v.Interface()
+	}
+	ops, err := pathlessOps(ps.patch.Op, value, ps.sch)
+	ps.throw(err)
+	for _, op := range ops {
+		ps.throw(applyPatch(op, subj, ps.sch, ps.opts))
+	}
+}
+
+// Break up the operation without a path into an operation for each attribute in its value, in the order of their names.
+// The attributes are resolved against the schema ignoring the case, as Path.CorrectCase does, and may be qualified by
+// the URN of the schema or of one of its extensions. Each operation takes the full path of its attribute.
+func pathlessOps(op string, value interface{}, schema *Schema) ([]Patch, error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidValue("Invalid parameter for %s operation", strings.ToLower(op))
+	}
+
+	ops := make([]Patch, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		p, _ := keyPath(k, schema)
+		if p == nil {
+			return nil, errInvalidPath("No attribute found for path: %s", k)
+		}
+		ops = append(ops, Patch{Op: op, Path: p.CollectValue(), Value: m[k]})
+	}
+	return ops, nil
+}
+
+func (ps *patchState) applyPatchAdd(p Path, v reflect.Value, subj *Resource) {
+	if p == nil {
+		ps.applyPatchPathless(v, subj)
 	} else {
 		basePath, lastPath := p.SeparateAtLast()
+		if basePath != nil && lastPath.FilterRoot() == nil && v.IsValid() {
+			ps.createBase(basePath, subj)
+		}
 		baseChannel := make(chan interface{}, 1)
 
 		if basePath == nil {
@@ -351,6 +615,7 @@ func (ps *patchState) applyPatchAdd(p Path, v reflect.Value, subj *Resource) {
 			baseChannel = subj.Get(basePath, ps.sch)
 		}
 
+		matched := 0
 		for base := range baseChannel {
 			baseVal := reflect.ValueOf(base)
 			if baseVal.IsNil() {
@@ -363,32 +628,16 @@ func (ps *patchState) applyPatchAdd(p Path, v reflect.Value, subj *Resource) {
 			switch baseVal.Kind() {
 			case reflect.Map:
 				keyVal := reflect.ValueOf(lastPath.Base())
-				if ps.destAttr.MultiValued {
-					origVal := baseVal.MapIndex(keyVal)
-					if !origVal.IsValid() {
-						switch v.Kind() {
-						case reflect.Array, reflect.Slice:
-							baseVal.SetMapIndex(keyVal, v)
-						default:
-							baseVal.SetMapIndex(keyVal, reflect.ValueOf([]interface{}{v.Interface()}))
-						}
-					} else {
-						if origVal.Kind() == reflect.Interface {
-							origVal = origVal.Elem()
-						}
-						var newArr MultiValued
-						switch v.Kind() {
-						case reflect.Array, reflect.Slice:
-							for i := 0; i < v.Len(); i++ {
-								newArr = MultiValued(origVal.Interface().([]interface{})).Add(v.Index(i).Interface())
-							}
-						default:
-							newArr = MultiValued(origVal.Interface().([]interface{})).Add(v.Interface())
-						}
-						baseVal.SetMapIndex(keyVal, reflect.ValueOf(newArr))
-					}
+				if ps.destAttr.MultiValued && lastPath.FilterRoot() != nil {
+					matched += ps.replaceElements(baseVal.MapIndex(keyVal), lastPath.FilterRoot(), v)
+				} else if ps.destAttr.MultiValued {
+					// values already present are not added again, see RFC 7644 section 3.5.2.1
+					orig, _ := multiValuedOf(baseVal.MapIndex(keyVal))
+					newArr := orig.AddUnique(ps.destAttr, elementsOf(v)...)
+					ps.notifyElements(ElementAdded, reflect.ValueOf([]interface{}(newArr[len(orig):])))
+					baseVal.SetMapIndex(keyVal, reflect.ValueOf([]interface{}(newArr)))
 				} else {
-					baseVal.SetMapIndex(keyVal, v)
+					ps.assignValue(baseVal, keyVal, v)
 				}
 			case reflect.Array, reflect.Slice:
 				for i := 0; i < baseVal.Len(); i++ {
@@ -398,14 +647,20 @@ func (ps *patchState) applyPatchAdd(p Path, v reflect.Value, subj *Resource) {
 					}
 					switch elemVal.Kind() {
 					case reflect.Map:
-						elemVal.SetMapIndex(reflect.ValueOf(lastPath.Base()), v)
+						keyVal := reflect.ValueOf(lastPath.Base())
+						ps.notify(ValueAssigned, elemVal.MapIndex(keyVal), v)
+						elemVal.SetMapIndex(keyVal, v)
 					default:
-						ps.throw(fmt.Errorf("Array base contains non-map: %s", ps.patch.Path))
+						ps.throw(errInvalidPath("Array base contains non-map: %s", ps.patch.Path))
 					}
 				}
 			default:
-				ps.throw(fmt.Errorf("Base evaluated to non-map and non-array: %s", ps.patch.Path))
+				ps.throw(errInvalidPath("Base evaluated to non-map and non-array: %s", ps.patch.Path))
 			}
 		}
+
+		if ps.destAttr.MultiValued && lastPath.FilterRoot() != nil && matched == 0 {
+			ps.throw(errNoTarget("No element matched the filter: %s", ps.pathText))
+		}
 	}
 }
@@ -3,6 +3,7 @@ package scimpatch
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"reflect"
 	"testing"
 )
@@ -35,6 +36,23 @@ func TestApplyPatchUsers(t *testing.T) {
 				assert.Equal(t, "foo", r.GetData()["name"].(map[string]interface{})["familyName"])
 			},
 		},
+		{
+			"add path qualified by schema",
+			Patch{Op: Add, Path: "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName", Value: "foo"},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", r.GetData()["name"].(map[string]interface{})["familyName"])
+			},
+		},
+		{
+			"replace path qualified by schema",
+			Patch{Op: Replace, Path: "URN:IETF:PARAMS:SCIM:SCHEMAS:CORE:2.0:USER:displayName", Value: "foo"},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", r.GetData()["displayName"])
+				assert.Nil(t, r.GetData()["urn:ietf:params:scim:schemas:core:2.0:User:displayName"])
+			},
+		},
 		{
 			"add simple path as AzureAD style",
 			Patch{Op: "Replace", Path: "displayName", Value: []interface{}{
@@ -72,6 +90,31 @@ func TestApplyPatchUsers(t *testing.T) {
 				assert.Equal(t, "bar", r.GetData()["externalId"])
 			},
 		},
+		{
+			"replace implicit path",
+			Patch{Op: Replace, Value: map[string]interface{}{
+				"active":   false,
+				"NICKNAME": "Dave",
+				"urn:ietf:params:scim:schemas:core:2.0:User:displayName": "Dave Qiu",
+				"name": map[string]interface{}{"givenName": "Dave"},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, false, r.GetData()["active"])
+				assert.Equal(t, "Dave", r.GetData()["nickName"])
+				assert.Equal(t, "Dave Qiu", r.GetData()["displayName"])
+				assert.Equal(t, "Dave", r.GetData()["name"].(map[string]interface{})["givenName"])
+				assert.Equal(t, "Qiu", r.GetData()["name"].(map[string]interface{})["familyName"])
+			},
+		},
+		{
+			"replace implicit path with unknown attribute",
+			Patch{Op: Replace, Value: map[string]interface{}{"active": false, "unknown": "foo"}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidPath, err.(*Error).ScimType)
+			},
+		},
 		{
 			"add multivalued",
 			Patch{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "foo@bar.com"}},
@@ -174,12 +217,39 @@ func TestApplyPatchUsers(t *testing.T) {
 				assert.NotEqual(t, "foo@bar.com", emailsVal.Index(1).Elem().MapIndex(reflect.ValueOf("value")).Interface())
 			},
 		},
+		{
+			"replace element with filter in other case",
+			Patch{Op: Replace, Path: "emails[type eq \"work\"]", Value: map[string]interface{}{"Value": "b@x.com", "DISPLAY": "work"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				emails := r.GetData()["emails"].([]interface{})
+				require.Equal(t, 2, len(emails))
+				assert.Equal(t, map[string]interface{}{"value": "b@x.com", "type": "work", "primary": true, "display": "work"}, emails[0])
+			},
+		},
 		{
 			"remove simple path",
-			Patch{Op: Remove, Path: "userName"},
+			Patch{Op: Remove, Path: "nickName"},
 			func(r *Resource, err error) {
 				assert.Nil(t, err)
-				assert.Nil(t, r.GetData()["userName"])
+				assert.Nil(t, r.GetData()["nickName"])
+			},
+		},
+		{
+			"replace multivalued with single element",
+			Patch{Op: Replace, Path: "emails", Value: map[string]interface{}{"value": "b@x.com"}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+				assert.IsType(t, []interface{}{}, r.GetData()["emails"])
+			},
+		},
+		{
+			"remove required path",
+			Patch{Op: Remove, Path: "userName"},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
 			},
 		},
 		{
@@ -403,6 +473,100 @@ func TestApplyPatchGroup(t *testing.T) {
 				assert.Nil(t, err)
 			},
 		},
+		{
+			"remove AzureAD style multiple members",
+			Patch{Op: "Remove", Path: "members", Value: []interface{}{
+				map[string]interface{}{"$ref": nil, "value": "not_found_member_id"},
+				map[string]interface{}{"value": "deleting_member_id"},
+				map[string]interface{}{"Value": "staying_member_id"},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				_, ok := r.GetData()["members"]
+				assert.False(t, ok)
+			},
+		},
+		{
+			"remove AzureAD style members of mixed shapes",
+			Patch{Op: "Remove", Path: "members", Value: []interface{}{
+				"deleting_member_id",
+				[]interface{}{map[string]interface{}{"value": "deleting_member_id"}},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{map[string]interface{}{"value": "staying_member_id"}}, r.GetData()["members"])
+			},
+		},
+		{
+			"remove AzureAD style member without value",
+			Patch{Op: "Remove", Path: "members", Value: []interface{}{
+				"deleting_member_id",
+				map[string]interface{}{"display": "no value"},
+			}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, AsError(err).ScimType)
+				assert.Equal(t, 2, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+		{
+			"remove AzureAD style member with value not in filter syntax",
+			Patch{Op: "Remove", Path: "members", Value: []interface{}{map[string]interface{}{"value": "a\"b"}}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, AsError(err).ScimType)
+				assert.Equal(t, 2, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+		{
+			"remove AzureAD style member by number",
+			Patch{Op: "Remove", Path: "members", Value: []interface{}{map[string]interface{}{"value": 1}}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, AsError(err).ScimType)
+				assert.Equal(t, 2, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+		{
+			"remove AzureAD style without any member",
+			Patch{Op: "Remove", Path: "members", Value: []interface{}{}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 2, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+		{
+			"add existing member",
+			Patch{Op: Add, Path: "members", Value: []interface{}{
+				map[string]interface{}{"value": "staying_member_id"},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 2, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+		{
+			"add existing and new members",
+			Patch{Op: Add, Path: "members", Value: []interface{}{
+				map[string]interface{}{"value": "staying_member_id"},
+				map[string]interface{}{"value": "added_member_id"},
+				map[string]interface{}{"value": "added_member_id"},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				members := r.GetData()["members"].([]interface{})
+				require.Equal(t, 3, len(members))
+				assert.Equal(t, "added_member_id", members[2].(map[string]interface{})["value"])
+			},
+		},
+		{
+			"add member differing in case",
+			Patch{Op: Add, Path: "members", Value: map[string]interface{}{"value": "STAYING_MEMBER_ID"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 2, len(r.GetData()["members"].([]interface{})))
+			},
+		},
 	} {
 		const TestGroupJson = `
 			{
@@ -560,3 +724,712 @@ func TestPatchValidate(t *testing.T) {
 		assert.Nil(t, mods.Validate())
 	})
 }
+
+func TestApplyModification(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	const TestUserJson = `
+		{
+			"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+			"id": "6B69753B-4E38-444E-8AC6-9D0E4D644D80",
+			"userName": "david@example.com",
+			"name": {
+				"familyName": "Qiu",
+				"givenName": "David"
+			},
+			"emails": [
+				{
+					"value": "david@example.com",
+					"type": "work"
+				}
+			]
+		}
+	`
+
+	for _, test := range []struct {
+		name      string
+		mod       Modification
+		assertion func(r *Resource, orig Complex, err error)
+	}{
+		{
+			"all operations succeed",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Replace, Path: "userName", Value: "foo"},
+				{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "foo@bar.com"}},
+				{Op: Remove, Path: "name.familyName"},
+			}},
+			func(r *Resource, orig Complex, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", r.GetData()["userName"])
+				assert.Equal(t, 2, len(r.GetData()["emails"].([]interface{})))
+				assert.Nil(t, r.GetData()["name"].(map[string]interface{})["familyName"])
+			},
+		},
+		{
+			"resource is untouched when an operation fails",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Replace, Path: "userName", Value: "foo"},
+				{Op: Remove, Path: "name.familyName"},
+				{Op: Add, Path: "dummy", Value: "foo"},
+			}},
+			func(r *Resource, orig Complex, err error) {
+				assert.NotNil(t, err)
+				assert.True(t, reflect.DeepEqual(orig, r.Complex))
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data := make(map[string]interface{}, 0)
+			err := json.Unmarshal([]byte(TestUserJson), &data)
+			assert.Nil(t, err)
+
+			resource := &Resource{Complex(data)}
+			orig := resource.Complex.Clone()
+			err = ApplyModification(test.mod, resource, schema)
+			test.assertion(resource, orig, err)
+		})
+	}
+}
+
+func TestApplyPatchMutability(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	assert.Nil(t, err)
+
+	groupSchema := &Schema{}
+	err = json.Unmarshal([]byte(GroupSchemaJson), &groupSchema)
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		schema    *Schema
+		patch     Patch
+		opts      []PatchOption
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"replace read only attribute",
+			userSchema,
+			Patch{Op: Replace, Path: "id", Value: "foo"},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeMutability, err.(*Error).ScimType)
+				assert.Equal(t, "6B69753B-4E38-444E-8AC6-9D0E4D644D80", r.GetData()["id"])
+			},
+		},
+		{
+			"replace read only sub attribute",
+			userSchema,
+			Patch{Op: Replace, Path: "meta.created", Value: "2020-01-01T00:00:00Z"},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeMutability, err.(*Error).ScimType)
+			},
+		},
+		{
+			"remove read only attribute",
+			userSchema,
+			Patch{Op: Remove, Path: "meta"},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeMutability, err.(*Error).ScimType)
+				assert.NotNil(t, r.GetData()["meta"])
+			},
+		},
+		{
+			"replace read only attribute ignored",
+			userSchema,
+			Patch{Op: Replace, Path: "id", Value: "foo"},
+			[]PatchOption{IgnoreReadOnlyWrites()},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "6B69753B-4E38-444E-8AC6-9D0E4D644D80", r.GetData()["id"])
+			},
+		},
+		{
+			"add implicit path with read only attributes ignored",
+			userSchema,
+			Patch{Op: Add, Value: map[string]interface{}{
+				"id":          "foo",
+				"displayName": "bar",
+				"meta":        map[string]interface{}{"created": "2020-01-01T00:00:00Z"},
+			}},
+			[]PatchOption{IgnoreReadOnlyWrites()},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "6B69753B-4E38-444E-8AC6-9D0E4D644D80", r.GetData()["id"])
+				assert.Equal(t, "bar", r.GetData()["displayName"])
+				assert.Equal(t, "2016-01-23T04:56:22Z", r.GetData()["meta"].(map[string]interface{})["created"])
+			},
+		},
+		{
+			"replace assigned immutable attribute",
+			groupSchema,
+			Patch{Op: Replace, Path: "members[value eq \"member_a\"].value", Value: "member_c"},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeMutability, err.(*Error).ScimType)
+			},
+		},
+		{
+			"replace element changing assigned immutable sub attribute",
+			groupSchema,
+			Patch{Op: Replace, Path: "members[value eq \"member_a\"]", Value: map[string]interface{}{"value": "member_c"}},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeMutability, err.(*Error).ScimType)
+				assert.Equal(t, "member_a", r.GetData()["members"].([]interface{})[0].(map[string]interface{})["value"])
+			},
+		},
+		{
+			"replace element keeping assigned immutable sub attribute",
+			groupSchema,
+			Patch{Op: Replace, Path: "members[value eq \"member_a\"]", Value: map[string]interface{}{"value": "member_a", "type": "User"}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "User", r.GetData()["members"].([]interface{})[0].(map[string]interface{})["type"])
+			},
+		},
+		{
+			"replace multivalued changing assigned immutable sub attributes",
+			groupSchema,
+			Patch{Op: Replace, Path: "members", Value: []interface{}{map[string]interface{}{"value": "member_c"}}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{map[string]interface{}{"value": "member_c"}}, r.GetData()["members"])
+			},
+		},
+		{
+			"replace multivalued keeping assigned immutable sub attributes",
+			groupSchema,
+			Patch{Op: Replace, Path: "members", Value: []interface{}{
+				map[string]interface{}{"value": "member_b"},
+				map[string]interface{}{"value": "member_a"},
+				map[string]interface{}{"value": "member_c"},
+			}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 3, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+		{
+			"add unassigned immutable attribute",
+			groupSchema,
+			Patch{Op: Add, Path: "members[value eq \"member_a\"].type", Value: "User"},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "User", r.GetData()["members"].([]interface{})[0].(map[string]interface{})["type"])
+			},
+		},
+		{
+			"add element with immutable sub attributes",
+			groupSchema,
+			Patch{Op: Add, Path: "members", Value: map[string]interface{}{"value": "member_c", "type": "User"}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 3, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+	} {
+		const TestResourceJson = `
+			{
+				"id": "6B69753B-4E38-444E-8AC6-9D0E4D644D80",
+				"displayName": "David Qiu",
+				"members": [
+					{ "value": "member_a" },
+					{ "value": "member_b" }
+				],
+				"meta": {
+					"created": "2016-01-23T04:56:22Z"
+				}
+			}
+		`
+
+		t.Run(test.name, func(t *testing.T) {
+			data := make(map[string]interface{}, 0)
+			err := json.Unmarshal([]byte(TestResourceJson), &data)
+			assert.Nil(t, err)
+
+			resource := &Resource{Complex(data)}
+			err = ApplyPatch(test.patch, resource, test.schema, test.opts...)
+			test.assertion(resource, err)
+		})
+	}
+}
+
+func TestApplyPatchFilterAtLast(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		patch     Patch
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"replace merges into matching element",
+			Patch{Op: Replace, Path: "emails[type eq \"work\"]", Value: map[string]interface{}{"value": "foo@bar.com"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				emails := r.GetData()["emails"].([]interface{})
+				require.Equal(t, 2, len(emails))
+				assert.Equal(t, map[string]interface{}{"value": "foo@bar.com", "type": "work", "primary": true}, emails[0])
+				assert.Equal(t, map[string]interface{}{"value": "david@home.com", "type": "home"}, emails[1])
+			},
+		},
+		{
+			"replace merges into every matching element",
+			Patch{Op: Replace, Path: "emails[value ew \".com\"]", Value: map[string]interface{}{"display": "david"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				emails := r.GetData()["emails"].([]interface{})
+				require.Equal(t, 2, len(emails))
+				assert.Equal(t, "david", emails[0].(map[string]interface{})["display"])
+				assert.Equal(t, "david", emails[1].(map[string]interface{})["display"])
+				assert.Equal(t, "home", emails[1].(map[string]interface{})["type"])
+			},
+		},
+		{
+			"replace with no matching element",
+			Patch{Op: Replace, Path: "emails[type eq \"other\"]", Value: map[string]interface{}{"value": "foo@bar.com"}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeNoTarget, err.(*Error).ScimType)
+				assert.Equal(t, "david@example.com", r.GetData()["emails"].([]interface{})[0].(map[string]interface{})["value"])
+			},
+		},
+		{
+			"add merges into matching element",
+			Patch{Op: Add, Path: "emails[type eq \"home\"]", Value: map[string]interface{}{"display": "home"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				emails := r.GetData()["emails"].([]interface{})
+				require.Equal(t, 2, len(emails))
+				assert.Nil(t, emails[0].(map[string]interface{})["display"])
+				assert.Equal(t, map[string]interface{}{"value": "david@home.com", "type": "home", "display": "home"}, emails[1])
+			},
+		},
+		{
+			"add with no matching element",
+			Patch{Op: Add, Path: "emails[type eq \"other\"]", Value: map[string]interface{}{"display": "other"}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeNoTarget, err.(*Error).ScimType)
+			},
+		},
+		{
+			"replace with multiple elements",
+			Patch{Op: Replace, Path: "emails[type eq \"work\"]", Value: []interface{}{
+				map[string]interface{}{"value": "foo@bar.com"},
+			}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{
+				"userName": "david",
+				"emails": []interface{}{
+					map[string]interface{}{"value": "david@example.com", "type": "work", "primary": true},
+					map[string]interface{}{"value": "david@home.com", "type": "home"},
+				},
+			}}
+			err := ApplyPatch(test.patch, resource, schema)
+			test.assertion(resource, err)
+		})
+	}
+}
+
+func TestApplyPatchPrimary(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	primaryOf := func(r *Resource) []interface{} {
+		flags := make([]interface{}, 0)
+		for _, elem := range r.GetData()["emails"].([]interface{}) {
+			flags = append(flags, elem.(map[string]interface{})["primary"])
+		}
+		return flags
+	}
+
+	for _, test := range []struct {
+		name      string
+		patch     Patch
+		opts      []PatchOption
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"add new primary element",
+			Patch{Op: Add, Path: "emails", Value: []interface{}{
+				map[string]interface{}{"value": "david@other.com", "type": "other", "primary": true},
+			}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{false, nil, true}, primaryOf(r))
+			},
+		},
+		{
+			"add non primary element",
+			Patch{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "david@other.com", "type": "other"}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{true, nil, nil}, primaryOf(r))
+			},
+		},
+		{
+			"replace primary flag through filter",
+			Patch{Op: Replace, Path: "emails[type eq \"home\"].primary", Value: true},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{false, true}, primaryOf(r))
+			},
+		},
+		{
+			"replace matching element with primary",
+			Patch{Op: Replace, Path: "emails[type eq \"home\"]", Value: map[string]interface{}{"primary": true}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{false, true}, primaryOf(r))
+			},
+		},
+		{
+			"replace keeping the existing primary",
+			Patch{Op: Replace, Path: "emails[type eq \"work\"]", Value: map[string]interface{}{"value": "foo@bar.com"}},
+			nil,
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{true, nil}, primaryOf(r))
+			},
+		},
+		{
+			"add multiple primary elements",
+			Patch{Op: Add, Path: "emails", Value: []interface{}{
+				map[string]interface{}{"value": "a@other.com", "primary": true},
+				map[string]interface{}{"value": "b@other.com", "primary": true},
+			}},
+			nil,
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			},
+		},
+		{
+			"add new primary element rejected",
+			Patch{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "david@other.com", "primary": true}},
+			[]PatchOption{RejectMultiplePrimary()},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			},
+		},
+		{
+			"add non primary element not rejected",
+			Patch{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "david@other.com", "primary": false}},
+			[]PatchOption{RejectMultiplePrimary()},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{true, nil, false}, primaryOf(r))
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{
+				"userName": "david",
+				"emails": []interface{}{
+					map[string]interface{}{"value": "david@example.com", "type": "work", "primary": true},
+					map[string]interface{}{"value": "david@home.com", "type": "home"},
+				},
+			}}
+			err := ApplyPatch(test.patch, resource, schema, test.opts...)
+			test.assertion(resource, err)
+		})
+	}
+}
+
+func TestApplyPatchComplexMerge(t *testing.T) {
+	const extensionUrn = "urn:example:scim:schemas:extension:Example:User"
+
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+	schema.Attributes = append(schema.Attributes, &Attribute{
+		Name:       extensionUrn,
+		Type:       TypeComplex,
+		Mutability: ReadWrite,
+		Assist:     &Assist{JSONName: extensionUrn, Path: extensionUrn, FullPath: extensionUrn},
+		SubAttributes: []*Attribute{
+			{
+				Name:       "department",
+				Type:       TypeString,
+				Mutability: ReadWrite,
+				Assist:     &Assist{JSONName: "department", Path: extensionUrn + ".department", FullPath: extensionUrn + ":department"},
+			},
+			{
+				Name:       "manager",
+				Type:       TypeComplex,
+				Mutability: ReadWrite,
+				Assist:     &Assist{JSONName: "manager", Path: extensionUrn + ".manager", FullPath: extensionUrn + ":manager"},
+				SubAttributes: []*Attribute{
+					{
+						Name:       "value",
+						Type:       TypeString,
+						Mutability: ReadWrite,
+						Assist:     &Assist{JSONName: "value", Path: extensionUrn + ".manager.value", FullPath: extensionUrn + ":manager.value"},
+					},
+					{
+						Name:       "displayName",
+						Type:       TypeString,
+						Mutability: ReadWrite,
+						Assist:     &Assist{JSONName: "displayName", Path: extensionUrn + ".manager.displayName", FullPath: extensionUrn + ":manager.displayName"},
+					},
+				},
+			},
+		},
+	})
+
+	for _, test := range []struct {
+		name      string
+		patch     Patch
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"replace complex",
+			Patch{Op: Replace, Path: "name", Value: map[string]interface{}{"givenName": "Bob"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "Bob", "familyName": "Qiu"}, r.GetData()["name"])
+			},
+		},
+		{
+			"add complex",
+			Patch{Op: Add, Path: "name", Value: map[string]interface{}{"middleName": "X"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "David", "familyName": "Qiu", "middleName": "X"}, r.GetData()["name"])
+			},
+		},
+		{
+			"sub attribute differing in case",
+			Patch{Op: Replace, Path: "name", Value: map[string]interface{}{"GIVENNAME": "Bob"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "Bob", "familyName": "Qiu"}, r.GetData()["name"])
+			},
+		},
+		{
+			"pathless add",
+			Patch{Op: Add, Value: map[string]interface{}{"name": map[string]interface{}{"givenName": "Bob"}}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "Bob", "familyName": "Qiu"}, r.GetData()["name"])
+			},
+		},
+		{
+			"complex within extension",
+			Patch{Op: Replace, Path: extensionUrn, Value: map[string]interface{}{
+				"manager": map[string]interface{}{"displayName": "Alice"},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{
+					"department": "Tour",
+					"manager":    map[string]interface{}{"value": "alice", "displayName": "Alice"},
+				}, r.GetData()[extensionUrn])
+			},
+		},
+		{
+			"pathless add within extension",
+			Patch{Op: Add, Value: map[string]interface{}{extensionUrn: map[string]interface{}{
+				"department": "Travel",
+				"manager":    map[string]interface{}{"value": "bob"},
+			}}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{
+					"department": "Travel",
+					"manager":    map[string]interface{}{"value": "bob"},
+				}, r.GetData()[extensionUrn])
+			},
+		},
+		{
+			"multivalued is replaced",
+			Patch{Op: Replace, Path: "emails", Value: []interface{}{map[string]interface{}{"value": "foo@bar.com"}}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{map[string]interface{}{"value": "foo@bar.com"}}, r.GetData()["emails"])
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{
+				"userName": "david",
+				"name":     map[string]interface{}{"givenName": "David", "familyName": "Qiu"},
+				"emails": []interface{}{
+					map[string]interface{}{"value": "david@example.com", "type": "work"},
+				},
+				extensionUrn: map[string]interface{}{
+					"department": "Tour",
+					"manager":    map[string]interface{}{"value": "alice"},
+				},
+			}}
+			err := ApplyPatch(test.patch, resource, schema)
+			test.assertion(resource, err)
+		})
+	}
+}
+
+func TestApplyPatchEnterpriseUser(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	require.Nil(t, err)
+	enterpriseSchema := &Schema{}
+	err = json.Unmarshal([]byte(EnterpriseUserSchemaJson), &enterpriseSchema)
+	require.Nil(t, err)
+	schema := ComposeSchema(userSchema, enterpriseSchema)
+
+	for _, test := range []struct {
+		name      string
+		data      Complex
+		patch     Patch
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"add attribute of absent extension",
+			Complex{"userName": "bjensen"},
+			Patch{Op: Add, Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber", Value: "701984"},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"employeeNumber": "701984"}, r.GetData()[EnterpriseUserUrn])
+			},
+		},
+		{
+			"replace attribute of extension as AzureAD style",
+			Complex{"userName": "bjensen", EnterpriseUserUrn: map[string]interface{}{"department": "Tour"}},
+			Patch{Op: "Replace", Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", Value: []interface{}{
+				map[string]interface{}{"$ref": nil, "value": "Travel"},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"department": "Travel"}, r.GetData()[EnterpriseUserUrn])
+			},
+		},
+		{
+			"replace sub attribute of absent manager",
+			Complex{"userName": "bjensen", EnterpriseUserUrn: map[string]interface{}{"department": "Tour"}},
+			Patch{Op: Replace, Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value", Value: "26118915"},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{
+					"department": "Tour",
+					"manager":    map[string]interface{}{"value": "26118915"},
+				}, r.GetData()[EnterpriseUserUrn])
+			},
+		},
+		{
+			"pathless add with extension",
+			Complex{"userName": "bjensen", EnterpriseUserUrn: map[string]interface{}{"department": "Tour"}},
+			Patch{Op: Add, Value: map[string]interface{}{
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{"costCenter": "4130"},
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"department": "Tour", "costCenter": "4130"}, r.GetData()[EnterpriseUserUrn])
+			},
+		},
+		{
+			"pathless add qualified by extension",
+			Complex{"userName": "bjensen", EnterpriseUserUrn: map[string]interface{}{"department": "Tour"}},
+			Patch{Op: Replace, Value: map[string]interface{}{
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:Department": "Travel",
+				"urn:ietf:params:scim:schemas:core:2.0:User:NickName":                   "Babs",
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"department": "Travel"}, r.GetData()[EnterpriseUserUrn])
+				assert.Equal(t, "Babs", r.GetData()["nickName"])
+			},
+		},
+		{
+			"pathless add with path keys",
+			Complex{"userName": "bjensen", "emails": []interface{}{map[string]interface{}{"value": "b@x.com", "type": "work"}}},
+			Patch{Op: Add, Value: map[string]interface{}{
+				"name.GivenName":                 "Barbara",
+				"emails[type eq \"work\"].value": "z@x.com",
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value": "26118915",
+			}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "Barbara"}, r.GetData()["name"])
+				assert.Equal(t, "z@x.com", r.GetData()["emails"].([]interface{})[0].(map[string]interface{})["value"])
+				assert.Equal(t, map[string]interface{}{
+					"manager": map[string]interface{}{"value": "26118915"},
+				}, r.GetData()[EnterpriseUserUrn])
+			},
+		},
+		{
+			"remove attribute of extension",
+			Complex{"userName": "bjensen", EnterpriseUserUrn: map[string]interface{}{"department": "Tour", "costCenter": "4130"}},
+			Patch{Op: Remove, Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:costCenter"},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"department": "Tour"}, r.GetData()[EnterpriseUserUrn])
+			},
+		},
+		{
+			"add absent complex in other case",
+			Complex{"userName": "bjensen"},
+			Patch{Op: Add, Path: "name", Value: map[string]interface{}{"GIVENNAME": "Barbara", "FamilyName": "Jensen"}},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"givenName": "Barbara", "familyName": "Jensen"}, r.GetData()["name"])
+				require.Nil(t, ApplyPatch(Patch{Op: Replace, Path: "name.givenName", Value: "Babs"}, r, schema))
+				assert.Equal(t, map[string]interface{}{"givenName": "Babs", "familyName": "Jensen"}, r.GetData()["name"])
+			},
+		},
+		{
+			"add sub attribute of absent complex",
+			Complex{"userName": "bjensen"},
+			Patch{Op: Add, Path: "name.familyName", Value: "Jensen"},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{"familyName": "Jensen"}, r.GetData()["name"])
+			},
+		},
+		{
+			"unknown attribute of extension",
+			Complex{"userName": "bjensen"},
+			Patch{Op: Add, Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:nickName", Value: "Babs"},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidPath, AsError(err).ScimType)
+				assert.Nil(t, r.GetData()[EnterpriseUserUrn])
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{test.data}
+			err := ApplyPatch(test.patch, resource, schema)
+			test.assertion(resource, err)
+		})
+	}
+}
@@ -15,6 +15,7 @@ type Path interface {
 	Next() Path                        // next Path, nil means this is the last one
 	Value() string                     // text value, unprocessed
 	Base() string                      // base Path value, i.e. 'groups' in 'groups[type Eq "direct"]'
+	URN() string                       // URN of the schema qualifying the Path, i.e. 'urn:ietf:params:scim:schemas:core:2.0:User' in 'urn:ietf:params:scim:schemas:core:2.0:User:userName'
 	FilterRoot() FilterNode            // root of the filter tree, i.e. 'Eq' in 'type Eq "direct"'
 	SeparateAtLast() (Path, Path)      // break up the path chain at the last node
 	CollectValue() string              // all path value downstream, separated by period.
@@ -45,7 +46,7 @@ const (
 func NewPath(text string) (Path, error) {
 	text = strings.TrimSpace(text)
 	if len(text) == 0 {
-		return nil, fmt.Errorf("Empty path: %s", text)
+		return nil, errInvalidPath("Empty path: %s", text)
 	}
 
 	var (
@@ -53,37 +54,50 @@ func NewPath(text string) (Path, error) {
 		thisPath   *path
 	)
 
+	urn, rest := splitUrn(text)
+
 	idx := -1
-	textMode := false
-	for i, r := range []rune(text) {
-		switch r {
+	textMode, depth := false, 0
+	for i := 0; i < len(rest) && idx == -1; i++ {
+		switch rest[i] {
 		case quoteRune:
 			textMode = !textMode
+		case leftBracketRune:
+			if !textMode {
+				depth++
+			}
+		case rightBracketRune:
+			if !textMode {
+				depth--
+			}
 		case periodRune:
-			if !textMode && strings.ToLower(text[:i]) != "urn:ietf:params:scim:schemas:core:2" {
+			if !textMode && depth == 0 {
 				idx = i
-				break
 			}
 		}
 	}
 
 	if idx == -1 {
-		this = text
+		this = rest
 	} else {
-		this = text[:idx]
-		next = text[idx+1:]
+		this = rest[:idx]
+		next = rest[idx+1:]
 	}
 
 	this = strings.TrimSpace(this)
 	if len(this) == 0 {
-		return nil, fmt.Errorf("Empty component: %s", text)
+		return nil, errInvalidPath("Empty component: %s", text)
 	} else {
+		thisText := this
+		if len(urn) > 0 {
+			thisText = urn + ":" + this
+		}
 		lbIdx := strings.Index(this, "[")
 		rbIdx := strings.Index(this, "]")
 
 		switch {
 		case lbIdx == -1 && rbIdx == -1:
-			thisPath = &path{text: this, base: this, next: nil, filterRoot: nil}
+			thisPath = &path{text: thisText, base: this, urn: urn, next: nil, filterRoot: nil}
 
 		case lbIdx > 0 && rbIdx > lbIdx+1 && rbIdx == len(this)-1:
 			thisBase := this[:lbIdx]
@@ -91,10 +105,10 @@ func NewPath(text string) (Path, error) {
 			if err != nil {
 				return nil, err
 			}
-			thisPath = &path{text: this, base: thisBase, next: nil, filterRoot: thisFilter.(*filterNode)}
+			thisPath = &path{text: thisText, base: thisBase, urn: urn, next: nil, filterRoot: thisFilter.(*filterNode)}
 
 		default:
-			return nil, fmt.Errorf("Invalid placement of filter brackets: %s", text)
+			return nil, errInvalidPath("Invalid placement of filter brackets: %s", text)
 		}
 	}
 
@@ -110,11 +124,75 @@ func NewPath(text string) (Path, error) {
 	return thisPath, nil
 }
 
+// Separate the URN of the schema qualifying the path from the rest of the path, see RFC 7644 section 3.10.
+// The path is separated at the last colon before any filter, as attribute names contain none. Whether the URN is
+// of the schema or of an extension, or is the name of an extension itself, is told by the schema the path resolves against.
+func splitUrn(text string) (string, string) {
+	if len(text) < len(urnPrefix) || !strings.EqualFold(text[:len(urnPrefix)], urnPrefix) {
+		return "", text
+	}
+	head := text
+	if lbIdx := strings.Index(text, "["); lbIdx != -1 {
+		head = text[:lbIdx]
+	}
+	if idx := strings.LastIndex(head, ":"); idx >= len(urnPrefix) {
+		return text[:idx], text[idx+1:]
+	}
+	return "", text
+}
+
+// Path to the schema extension qualifying the path, followed by the path within the extension, when the guide holds
+// the extension as a complex attribute named by its URN, see ComposeSchema. nil when the path is not qualified by
+// the URN of an extension the guide holds.
+func extensionPath(p Path, guide AttributeSource) Path {
+	urn := p.URN()
+	if len(urn) == 0 || strings.EqualFold(urn, p.Base()) || guide.GetAttribute(p, false) != nil {
+		return nil
+	}
+	ext := &path{text: urn, base: urn, urn: urn}
+	if attr := guide.GetAttribute(ext, false); attr == nil || !attr.ExpectsComplex() {
+		return nil
+	}
+	ext.next = &path{text: p.Value()[len(urn)+1:], base: p.Base(), filterRoot: p.FilterRoot(), next: p.Next()}
+	return ext
+}
+
+// path to the attribute named by the key of a JSON object, which may be qualified by the URN of the schema
+func attributePath(name string) Path {
+	urn, rest := splitUrn(name)
+	if len(urn) == 0 || len(rest) == 0 {
+		return &path{text: name, base: name, urn: urn}
+	}
+	return &path{text: name, base: rest, urn: urn}
+}
+
+// path to the attribute named by the key of a JSON object, resolved against the guide with the case corrected, see
+// Path.CorrectCase, along with the attribute. The key is any path, such as 'name.givenName', and may be qualified by the
+// URN of the schema or of one of its extensions. nil when the key does not name an attribute of the guide.
+func keyPath(key string, guide AttributeSource) (Path, *Attribute) {
+	p, err := NewPath(key)
+	if err != nil {
+		return nil, nil
+	}
+	p.CorrectCase(guide, true)
+	attr := guide.GetAttribute(p, true)
+	if attr == nil {
+		return nil, nil
+	}
+	return p, attr
+}
+
 // create a new filter from text
-func NewFilter(text string) (FilterNode, error) {
+func NewFilter(text string) (root FilterNode, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			root, err = nil, errInvalidFilter("Invalid filter: %v", r)
+		}
+	}()
+
 	text = strings.TrimSpace(text)
 	if len(text) == 0 {
-		return nil, fmt.Errorf("Empty filter: %s", text)
+		return nil, errInvalidFilter("Empty filter: %s", text)
 	}
 
 	tokenizer := &filterTokenizer{
@@ -124,7 +202,7 @@ func NewFilter(text string) (FilterNode, error) {
 		tokens:    make([]*filterNode, 0),
 	}
 	if err := tokenizer.tokenize(); err != nil {
-		return nil, fmt.Errorf("Invalid filter: %s", err.Error())
+		return nil, errInvalidFilter("Invalid filter: %s", err.Error())
 	}
 
 	sy := &shuntingYard{
@@ -132,16 +210,18 @@ func NewFilter(text string) (FilterNode, error) {
 		operator: NewStackWithoutLimit(),
 		output:   NewStackWithoutLimit(),
 	}
-	root, err := sy.run(tokenizer.tokens)
+	node, err := sy.run(tokenizer.tokens)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid filter: %s", err.Error())
+		return nil, errInvalidFilter("Invalid filter: %s", err.Error())
 	}
 
-	return root, nil
+	return node, nil
 }
 
 // filter tokenizer
 const (
+	urnPrefix = "urn:"
+
 	spaceRune        = ' '
 	quoteRune        = '"'
 	commaRune        = ','
@@ -311,8 +391,9 @@ func (f tokenFactory) create(text string) *filterNode {
 	default:
 		if strings.HasPrefix(text, "\"") && strings.HasSuffix(text, "\"") {
 			return &filterNode{data: text[1 : len(text)-1], typ: ConstantOperand}
-		} else if b, err := strconv.ParseBool(text); err == nil {
-			return &filterNode{data: b, typ: ConstantOperand}
+		} else if strings.EqualFold(text, "true") || strings.EqualFold(text, "false") {
+			// only the literals, as strconv.ParseBool takes 1 and 0 for booleans as well
+			return &filterNode{data: strings.EqualFold(text, "true"), typ: ConstantOperand}
 		} else if i, err := strconv.ParseInt(text, 10, 64); err == nil {
 			return &filterNode{data: i, typ: ConstantOperand}
 		} else if f, err := strconv.ParseFloat(text, 64); err == nil {
@@ -466,12 +547,14 @@ type path struct {
 	next       Path
 	text       string
 	base       string
+	urn        string
 	filterRoot FilterNode
 }
 
 func (p *path) Next() Path             { return p.next }
 func (p *path) Value() string          { return p.text }
 func (p *path) Base() string           { return p.base }
+func (p *path) URN() string            { return p.urn }
 func (p *path) FilterRoot() FilterNode { return p.filterRoot }
 
 func (p *path) SeparateAtLast() (Path, Path) {
@@ -490,23 +573,67 @@ func (p *path) SeparateAtLast() (Path, Path) {
 }
 
 func (p *path) CollectValue() string {
-	v := make([]string, 0)
-	var c Path = p
-	for c != nil {
-		v = append(v, c.Value())
-		c = c.Next()
+	v, sep := "", ""
+	for c := Path(p); c != nil; c = c.Next() {
+		v += sep + c.Value()
+		sep = segmentSeparator(c)
+	}
+	return v
+}
+
+// separator of the segment from the next, which is qualified by the URN when the segment is to a schema extension
+func segmentSeparator(p Path) string {
+	if len(p.URN()) > 0 && strings.EqualFold(p.URN(), p.Base()) {
+		return ":"
+	}
+	return "."
+}
+
+// Prefix of the paths to the sub attributes of the attribute at the path. The attributes of a schema extension are
+// qualified by its URN, see RFC 7644 section 3.10. The extension is told by its name, as attribute names contain no colon.
+func subPathPrefix(p string, attr *Attribute) string {
+	switch {
+	case len(p) == 0:
+		return ""
+	case attr != nil && len(attr.Name) > len(urnPrefix) && strings.EqualFold(attr.Name[:len(urnPrefix)], urnPrefix):
+		return p + ":"
+	default:
+		return p + "."
 	}
-	return strings.Join(v, ".")
 }
 
 func (p *path) CorrectCase(guide AttributeSource, recursive bool) {
+	if ext := extensionPath(p, guide); ext != nil {
+		*p = *ext.(*path)
+	}
+
 	attr := guide.GetAttribute(p, false)
+	if attr == nil {
+		return
+	}
 
-	switch strings.ToLower(p.base) {
-	case strings.ToLower(attr.Name):
+	filter := ""
+	if lbIdx := strings.Index(p.text, "["); lbIdx != -1 {
+		filter = p.text[lbIdx:]
+	}
+
+	switch {
+	case len(p.urn) > 0 && (strings.EqualFold(p.urn, p.base) || strings.EqualFold(p.urn+":"+p.base, attr.Name)):
+		// the schema extension, named by its URN
+		p.urn, p.base = attr.Name, attr.Name
+	case len(p.urn) > 0:
+		if fullPath := attr.Assist.FullPath; len(fullPath) > len(p.urn) && strings.EqualFold(fullPath[:len(p.urn)+1], p.urn+":") {
+			p.urn = fullPath[:len(p.urn)]
+		}
+		p.base = attr.Name
+	default:
 		p.base = attr.Name
-	case strings.ToLower(attr.Assist.FullPath):
-		p.base = attr.Assist.FullPath
+	}
+
+	if len(p.urn) > 0 && p.urn != p.base {
+		p.text = p.urn + ":" + p.base + filter
+	} else {
+		p.text = p.base + filter
 	}
 
 	if p.filterRoot != nil {
@@ -59,6 +59,82 @@ func TestNewPath(t *testing.T) {
 				assert.Nil(t, head.Next().Next())
 			},
 		},
+		{
+			"triplex",
+			"a.b.c",
+			func(head Path, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "a", head.Base())
+				assert.Equal(t, "b", head.Next().Base())
+				assert.Equal(t, "c", head.Next().Next().Base())
+			},
+		},
+		{
+			"qualified by core schema",
+			"urn:ietf:params:scim:schemas:core:2.0:User:name.familyName",
+			func(head Path, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, UserUrn, head.URN())
+				assert.Equal(t, "name", head.Base())
+				assert.Equal(t, "familyName", head.Next().Base())
+				assert.Equal(t, "", head.Next().URN())
+				assert.Equal(t, "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName", head.CollectValue())
+			},
+		},
+		{
+			"qualified by core schema with filter",
+			"urn:ietf:params:scim:schemas:core:2.0:User:emails[value eq \"david@foo.com\"].type",
+			func(head Path, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, UserUrn, head.URN())
+				assert.Equal(t, "emails", head.Base())
+				assert.Equal(t, Eq, head.FilterRoot().Data())
+				assert.Equal(t, "type", head.Next().Base())
+			},
+		},
+		{
+			"qualified by schema extension",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value",
+			func(head Path, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, EnterpriseUserUrn, head.URN())
+				assert.Equal(t, "manager", head.Base())
+				assert.Equal(t, "value", head.Next().Base())
+				assert.Nil(t, head.Next().Next())
+				assert.Equal(t, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value", head.CollectValue())
+			},
+		},
+		{
+			"schema extension, told apart by the schema only",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User",
+			func(head Path, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "urn:ietf:params:scim:schemas:extension:enterprise:2.0", head.URN())
+				assert.Equal(t, "User", head.Base())
+				assert.Nil(t, head.Next())
+				assert.Equal(t, EnterpriseUserUrn, head.CollectValue())
+			},
+		},
+		{
+			"qualified by custom schema",
+			"urn:acme:schemas:1.0:Device:serial",
+			func(head Path, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "urn:acme:schemas:1.0:Device", head.URN())
+				assert.Equal(t, "serial", head.Base())
+				assert.Nil(t, head.Next())
+			},
+		},
+		{
+			"qualified by custom schema with version",
+			"urn:acme:schemas:2.0:Router:ports.speed",
+			func(head Path, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "urn:acme:schemas:2.0:Router", head.URN())
+				assert.Equal(t, "ports", head.Base())
+				assert.Equal(t, "speed", head.Next().Base())
+			},
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			test.assertion(NewPath(test.text))
@@ -110,6 +186,16 @@ func TestNewFilter(t *testing.T) {
 				assert.Equal(t, true, root.Right().Data())
 			},
 		},
+		{
+			"integer",
+			"count eq 1 or count lt 0",
+			func(root FilterNode, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, Or, root.Data())
+				assert.Equal(t, int64(1), root.Left().Right().Data())
+				assert.Equal(t, int64(0), root.Right().Right().Data())
+			},
+		},
 		{
 			"sw",
 			"username sw \"david\"",
@@ -284,6 +370,17 @@ func TestNewFilter(t *testing.T) {
 				assert.Nil(t, root.Right())
 			},
 		},
+		{
+			"qualified by schema",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq \"701984\"",
+			func(root FilterNode, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, Eq, root.Data())
+				assert.Equal(t, EnterpriseUserUrn, root.Left().Data().(Path).URN())
+				assert.Equal(t, "employeeNumber", root.Left().Data().(Path).Base())
+				assert.Equal(t, "701984", root.Right().Data())
+			},
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			test.assertion(NewFilter(test.text))
@@ -354,7 +451,9 @@ func TestPath_CorrectCase(t *testing.T) {
 		{
 			fmt.Sprintf("%s:UserName", strings.ToLower(UserUrn)),
 			func(p Path) {
-				assert.Equal(t, fmt.Sprintf("%s:userName", UserUrn), p.Base())
+				assert.Equal(t, UserUrn, p.URN())
+				assert.Equal(t, "userName", p.Base())
+				assert.Equal(t, fmt.Sprintf("%s:userName", UserUrn), p.Value())
 			},
 		},
 		{
@@ -367,7 +466,8 @@ func TestPath_CorrectCase(t *testing.T) {
 		{
 			fmt.Sprintf("%s:Name.FamilyName", strings.ToLower(UserUrn)),
 			func(p Path) {
-				assert.Equal(t, fmt.Sprintf("%s:name", UserUrn), p.Base())
+				assert.Equal(t, UserUrn, p.URN())
+				assert.Equal(t, "name", p.Base())
 				assert.Equal(t, "familyName", p.Next().Base())
 			},
 		},
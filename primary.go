@@ -0,0 +1,82 @@
+package scimpatch
+
+import (
+	"reflect"
+)
+
+// Path to the multivalued holding the primary flag written by the patch, i.e. 'emails' for 'emails[type eq "work"].primary'.
+// nil if the patch does not write to a multivalued complex attribute having the 'primary' sub attribute.
+func (ps *patchState) primaryTarget(p Path) (Path, *Attribute) {
+	var guide AttributeSource = ps.sch
+	bases, sep := "", ""
+	for c := p; c != nil; c = c.Next() {
+		attr := guide.GetAttribute(c, false)
+		if attr == nil {
+			return nil, nil
+		}
+		bases += sep + c.Base()
+		sep = segmentSeparator(c)
+		if attr.ExpectsComplexArray() && attr.SubAttribute(primaryKey) != nil {
+			target, err := NewPath(bases)
+			if err != nil {
+				return nil, nil
+			}
+			return target, attr
+		}
+		guide = attr
+	}
+	return nil, nil
+}
+
+// identities of the elements currently flagged as primary, taken before the patch is applied
+func primaryElements(p Path, subj *Resource, guide AttributeSource) map[uintptr]bool {
+	flagged := make(map[uintptr]bool)
+	for arr := range subj.Get(p, guide) {
+		if mv, ok := multiValuedOf(reflect.ValueOf(arr)); ok {
+			for _, elem := range mv {
+				if isPrimary(elem) {
+					flagged[reflect.ValueOf(elem).Pointer()] = true
+				}
+			}
+		}
+	}
+	return flagged
+}
+
+// Keep the primary flag unique within the multivalued after the patch, see RFC 7643 section 2.4.
+// Elements which were flagged before the patch lose the flag to the elements newly flagged by the patch, unless
+// multiple primary elements are to be rejected. Flagging more than one element with a single patch is always rejected.
+func (ps *patchState) enforcePrimary(p Path, attr *Attribute, before map[uintptr]bool, subj *Resource) {
+	for arr := range subj.Get(p, ps.sch) {
+		mv, ok := multiValuedOf(reflect.ValueOf(arr))
+		if !ok {
+			continue
+		}
+
+		prior, flagged := make([]int, 0), make([]int, 0)
+		for i, elem := range mv {
+			if !isPrimary(elem) {
+				continue
+			}
+			if before[reflect.ValueOf(elem).Pointer()] {
+				prior = append(prior, i)
+			} else {
+				flagged = append(flagged, i)
+			}
+		}
+
+		switch {
+		case len(flagged) > 1:
+			ps.throw(errInvalidValue("The primary attribute value 'true' must appear no more than once: %s", ps.pathText))
+		case len(flagged) == 1 && len(prior) > 0:
+			if ps.opts.rejectMultiplePrimary {
+				ps.throw(errInvalidValue("Another element is already primary: %s", ps.pathText))
+			}
+			for _, i := range prior {
+				oldElem := reflect.ValueOf(deepCopy(mv.Get(i)))
+				mv.Get(i).(map[string]interface{})[primaryKey] = false
+				ps.notifyAttribute(attr, ElementReplaced, oldElem, reflect.ValueOf(mv.Get(i)))
+			}
+		}
+	}
+}
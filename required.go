@@ -0,0 +1,64 @@
+package scimpatch
+
+import (
+	"reflect"
+)
+
+// Enforce the required attributes after the patch, see RFC 7643 section 2.2.
+// Every required attribute has to stay assigned, including the required sub attributes of the complex values present.
+// Required attributes which were already unassigned before the patch are tolerated, so that resources stored before
+// the schema required them can still be patched. The attributes are counted by their full path, as elements of a
+// multivalued attribute cannot be told apart across the patch.
+type requiredCheck struct {
+	sch     *Schema
+	missing map[string]int // number of unassigned required attributes before the patch, by full path
+}
+
+// count the unassigned required attributes of the resource before the patch
+func newRequiredCheck(before Complex, schema *Schema) *requiredCheck {
+	check := &requiredCheck{sch: schema, missing: make(map[string]int)}
+	unassignedRequired(before, schema.ToAttribute(), func(attr *Attribute) {
+		check.missing[attr.Assist.FullPath]++
+	})
+	return check
+}
+
+// fail with invalidValue if the patch left more required attributes unassigned than there were before
+func (check *requiredCheck) enforce(after Complex) error {
+	var err error
+	unassignedRequired(after, check.sch.ToAttribute(), func(attr *Attribute) {
+		check.missing[attr.Assist.FullPath]--
+		if check.missing[attr.Assist.FullPath] < 0 && err == nil {
+			err = errInvalidValue("Required attribute is not assigned: %s", attr.Assist.FullPath)
+		}
+	})
+	return err
+}
+
+// report every required sub attribute unassigned in the complex value, looking into the complex values assigned
+func unassignedRequired(c map[string]interface{}, guide *Attribute, report func(attr *Attribute)) {
+	for _, attr := range guide.SubAttributes {
+		v := lookup(c, attr.Name)
+		if !attr.Assigned(reflect.ValueOf(v)) {
+			if attr.Required {
+				report(attr)
+			}
+			continue
+		}
+
+		switch {
+		case attr.ExpectsComplex():
+			if m, ok := v.(map[string]interface{}); ok {
+				unassignedRequired(m, attr, report)
+			}
+		case attr.ExpectsComplexArray():
+			if elems, ok := v.([]interface{}); ok {
+				for _, elem := range elems {
+					if m, ok := elem.(map[string]interface{}); ok {
+						unassignedRequired(m, attr, report)
+					}
+				}
+			}
+		}
+	}
+}
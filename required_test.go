@@ -0,0 +1,130 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApplyModificationRequired(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	require.Nil(t, err)
+	// emails.value is not required by RFC 7643, but is required here to cover required sub attributes
+	emailValue, err := NewPath("emails.value")
+	require.Nil(t, err)
+	userSchema.GetAttribute(emailValue, true).Required = true
+
+	groupSchema := &Schema{}
+	err = json.Unmarshal([]byte(GroupSchemaJson), &groupSchema)
+	require.Nil(t, err)
+	// displayName is described as REQUIRED, but not marked as required by the schema of RFC 7643
+	displayName, err := NewPath("displayName")
+	require.Nil(t, err)
+	groupSchema.GetAttribute(displayName, true).Required = true
+
+	for _, test := range []struct {
+		name     string
+		schema   *Schema
+		data     Complex
+		ops      []Patch
+		required string
+	}{
+		{
+			"remove group displayName",
+			groupSchema,
+			Complex{"displayName": "Tour Guides"},
+			[]Patch{{Op: Remove, Path: "displayName"}},
+			"urn:ietf:params:scim:schemas:core:2.0:Group:displayName",
+		},
+		{
+			"replace userName with empty string",
+			userSchema,
+			Complex{"userName": "david"},
+			[]Patch{{Op: Replace, Path: "userName", Value: ""}},
+			"urn:ietf:params:scim:schemas:core:2.0:User:userName",
+		},
+		{
+			"remove and assign userName again",
+			userSchema,
+			Complex{"userName": "david"},
+			[]Patch{{Op: Remove, Path: "userName"}, {Op: Add, Path: "userName", Value: "foo"}},
+			"",
+		},
+		{
+			"already unassigned",
+			userSchema,
+			Complex{"nickName": "Q"},
+			[]Patch{{Op: Remove, Path: "nickName"}},
+			"",
+		},
+		{
+			"add email without value",
+			userSchema,
+			Complex{"userName": "david"},
+			[]Patch{{Op: Add, Path: "emails", Value: map[string]interface{}{"type": "work"}}},
+			"urn:ietf:params:scim:schemas:core:2.0:User:emails.value",
+		},
+		{
+			"remove value of email",
+			userSchema,
+			Complex{"userName": "david", "emails": []interface{}{
+				map[string]interface{}{"value": "david@example.com", "type": "work"},
+				map[string]interface{}{"value": "david@home.com", "type": "home"},
+			}},
+			[]Patch{{Op: Remove, Path: "emails[type eq \"home\"].value"}},
+			"urn:ietf:params:scim:schemas:core:2.0:User:emails.value",
+		},
+		{
+			"email already without value",
+			userSchema,
+			Complex{"userName": "david", "emails": []interface{}{
+				map[string]interface{}{"type": "work"},
+			}},
+			[]Patch{{Op: Replace, Path: "emails[type eq \"work\"].display", Value: "work"}},
+			"",
+		},
+		{
+			"remove email",
+			userSchema,
+			Complex{"userName": "david", "emails": []interface{}{
+				map[string]interface{}{"value": "david@example.com", "type": "work"},
+			}},
+			[]Patch{{Op: Remove, Path: "emails"}},
+			"",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{test.data}
+			original := test.data.Clone()
+			err := ApplyModification(Modification{Schemas: []string{PatchOpUrn}, Ops: test.ops}, resource, test.schema)
+			if len(test.required) == 0 {
+				assert.Nil(t, err)
+				_, _, err = DryRunModification(Modification{Schemas: []string{PatchOpUrn}, Ops: test.ops}, &Resource{original}, test.schema)
+				assert.Nil(t, err)
+				return
+			}
+
+			require.NotNil(t, err)
+			assert.Equal(t, ScimTypeInvalidValue, err.(*Error).ScimType)
+			assert.Equal(t, "Required attribute is not assigned: "+test.required, err.Error())
+			assert.Equal(t, original, resource.GetData())
+
+			_, _, err = DryRunModification(Modification{Schemas: []string{PatchOpUrn}, Ops: test.ops}, resource, test.schema)
+			require.NotNil(t, err)
+			assert.Equal(t, "Required attribute is not assigned: "+test.required, err.Error())
+
+			if len(test.ops) == 1 {
+				changes := make([]Change, 0)
+				err = ApplyPatch(test.ops[0], resource, test.schema, WithObserver(ChangeObserverFunc(func(c Change) {
+					changes = append(changes, c)
+				})))
+				require.NotNil(t, err)
+				assert.Equal(t, "Required attribute is not assigned: "+test.required, err.Error())
+				assert.Equal(t, original, resource.GetData())
+				assert.Empty(t, changes)
+			}
+		})
+	}
+}
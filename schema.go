@@ -2,7 +2,6 @@ package scimpatch
 
 import (
 	"encoding/json"
-	"fmt"
 	"reflect"
 	"strings"
 )
@@ -31,29 +30,70 @@ func (s *Schema) ToAttribute() *Attribute {
 
 func (s *Schema) GetAttribute(p Path, recursive bool) *Attribute {
 	for _, attr := range s.Attributes {
-		if strings.ToLower(attr.Name) == strings.ToLower(p.Base()) {
-			if recursive {
-				return attr.GetAttribute(p.Next(), recursive)
-			} else {
-				return attr
-			}
+		if !s.names(p, attr) {
+			continue
+		}
+		if recursive {
+			return attr.GetAttribute(p.Next(), recursive)
 		} else {
-			switch attr.Name {
-			case "schemas", "id", "externalId", "meta":
-			default:
-				if strings.ToLower(fmt.Sprintf("%s:%s", s.Id, attr.Name)) == strings.ToLower(p.Base()) {
-					if recursive {
-						return attr.GetAttribute(p.Next(), recursive)
-					} else {
-						return attr
-					}
-				}
-			}
+			return attr
+		}
+	}
+	if recursive {
+		if ext := extensionPath(p, s); ext != nil {
+			return s.GetAttribute(ext, recursive)
 		}
 	}
 	return nil
 }
 
+// whether the segment of the path names the attribute. The attributes common to all resources are not qualified by
+// the URN of the schema, see RFC 7643 section 3.1, while the schema extension is named by its own URN, which is taken
+// as the URN qualifying an attribute when the URN is not registered.
+func (s *Schema) names(p Path, attr *Attribute) bool {
+	name, urn, base := strings.ToLower(attr.Name), strings.ToLower(p.URN()), strings.ToLower(p.Base())
+	switch urn {
+	case "", name:
+		return name == base
+	case strings.ToLower(s.Id):
+		switch attr.Name {
+		case "schemas", "id", "externalId", "meta":
+			return false
+		}
+		return name == base
+	default:
+		return name == urn+":"+base
+	}
+}
+
+// Compose the schema of a resource type out of its core schema and its schema extensions, see RFC 7643 section 3.3.
+// Each extension becomes a complex attribute of the resource named by the URN of the extension, which holds the
+// attributes of the extension, so that paths qualified by the URN, such as
+// urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value, resolve against the composed schema.
+func ComposeSchema(core *Schema, extensions ...*Schema) *Schema {
+	composed := &Schema{
+		Schemas:     core.Schemas,
+		Id:          core.Id,
+		Name:        core.Name,
+		Description: core.Description,
+		Attributes:  make([]*Attribute, 0, len(core.Attributes)+len(extensions)),
+	}
+	composed.Attributes = append(composed.Attributes, core.Attributes...)
+	for _, ext := range extensions {
+		composed.Attributes = append(composed.Attributes, &Attribute{
+			Name:          ext.Id,
+			Type:          TypeComplex,
+			SubAttributes: ext.Attributes,
+			Description:   ext.Description,
+			Mutability:    ReadWrite,
+			Returned:      Default,
+			Uniqueness:    None,
+			Assist:        &Assist{JSONName: ext.Id, Path: ext.Id, FullPath: ext.Id},
+		})
+	}
+	return composed
+}
+
 type Attribute struct {
 	Name            string       `json:"name,omitempty"`
 	Type            string       `json:"type,omitempty"`
@@ -228,6 +268,16 @@ func (a *Attribute) GetAttribute(p Path, recursive bool) *Attribute {
 	return nil
 }
 
+// get the sub attribute by its name, case insensitive
+func (a *Attribute) SubAttribute(name string) *Attribute {
+	for _, subAttr := range a.SubAttributes {
+		if strings.ToLower(subAttr.Name) == strings.ToLower(name) {
+			return subAttr
+		}
+	}
+	return nil
+}
+
 type Assist struct {
 	JSONName      string   `json:"_jsonName"`      // JSON field name used to render this field
 	Path          string   `json:"_path"`          // period delimited field names, useful to retrieve nested fields
@@ -236,17 +286,18 @@ type Assist struct {
 }
 
 const (
-	UserUrn         = "urn:ietf:params:scim:schemas:core:2.0:User"
-	GroupUrn        = "urn:ietf:params:scim:schemas:core:2.0:Group"
-	ResourceTypeUrn = "urn:ietf:params:scim:schemas:core:2.0:resourceType"
-	SPConfigUrn     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
-	SchemaUrn       = "urn:ietf:params:scim:schemas:core:2.0:Schema"
-	ErrorUrn        = "urn:ietf:params:scim:api:messages:2.0:Error"
-	ListResponseUrn = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
-	PatchOpUrn      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
-	SearchUrn       = "urn:ietf:params:scim:api:messages:2.0:SearchRequest"
-	BulkRequestUrn  = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
-	BulkResponseUrn = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	UserUrn           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupUrn          = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	EnterpriseUserUrn = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	ResourceTypeUrn   = "urn:ietf:params:scim:schemas:core:2.0:resourceType"
+	SPConfigUrn       = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaUrn         = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	ErrorUrn          = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ListResponseUrn   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpUrn        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SearchUrn         = "urn:ietf:params:scim:api:messages:2.0:SearchRequest"
+	BulkRequestUrn    = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	BulkResponseUrn   = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
 
 	TypeString    = "string"
 	TypeBoolean   = "boolean"
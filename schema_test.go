@@ -73,3 +73,130 @@ func TestSchema_GetAttribute(t *testing.T) {
 		})
 	}
 }
+
+func TestComposeSchema(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	require.Nil(t, err)
+	enterpriseSchema := &Schema{}
+	err = json.Unmarshal([]byte(EnterpriseUserSchemaJson), &enterpriseSchema)
+	require.Nil(t, err)
+	assert.Equal(t, EnterpriseUserUrn, enterpriseSchema.Id)
+
+	schema := ComposeSchema(userSchema, enterpriseSchema)
+	assert.Equal(t, UserUrn, schema.Id)
+	assert.Equal(t, len(userSchema.Attributes)+1, len(schema.Attributes))
+
+	data := Complex{
+		"userName": "bjensen",
+		EnterpriseUserUrn: map[string]interface{}{
+			"employeeNumber": "701984",
+			"manager":        map[string]interface{}{"value": "26118915-6090-4610-87a4-49d0aa9d5a2b", "displayName": "John Smith"},
+		},
+	}
+
+	t.Run("get attribute", func(t *testing.T) {
+		for pathText, fullPath := range map[string]string{
+			"userName": "urn:ietf:params:scim:schemas:core:2.0:User:userName",
+			"urn:ietf:params:scim:schemas:core:2.0:User:name.familyName":                 "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User":                 EnterpriseUserUrn,
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber":  EnterpriseUserUrn + ":employeeNumber",
+			"URN:IETF:PARAMS:SCIM:SCHEMAS:EXTENSION:ENTERPRISE:2.0:USER:manager.value":   EnterpriseUserUrn + ":manager.value",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.$ref":    EnterpriseUserUrn + ":manager.$ref",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.display": "",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:userName":        "",
+		} {
+			p, err := NewPath(pathText)
+			require.Nil(t, err)
+			attr := schema.GetAttribute(p, true)
+			if len(fullPath) == 0 {
+				assert.Nil(t, attr, pathText)
+				continue
+			}
+			require.NotNil(t, attr, pathText)
+			assert.Equal(t, fullPath, attr.Assist.FullPath)
+		}
+	})
+
+	t.Run("correct case", func(t *testing.T) {
+		p, err := NewPath("urn:ietf:params:scim:schemas:extension:enterprise:2.0:user:Manager.Value")
+		require.Nil(t, err)
+		p.CorrectCase(schema, true)
+		assert.Equal(t, EnterpriseUserUrn, p.Base())
+		assert.Equal(t, "manager", p.Next().Base())
+		assert.Equal(t, "value", p.Next().Next().Base())
+		assert.Equal(t, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value", p.CollectValue())
+
+		p, err = NewPath("urn:ietf:params:scim:schemas:extension:enterprise:2.0:user")
+		require.Nil(t, err)
+		p.CorrectCase(schema, true)
+		assert.Equal(t, EnterpriseUserUrn, p.URN())
+		assert.Equal(t, EnterpriseUserUrn, p.Base())
+		assert.Equal(t, EnterpriseUserUrn, p.Value())
+	})
+
+	t.Run("extension on its own", func(t *testing.T) {
+		resource := &Resource{Complex{}}
+		err := ApplyPatch(Patch{Op: Add, Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", Value: "Tour"}, resource, enterpriseSchema)
+		require.Nil(t, err)
+		assert.Equal(t, Complex{"department": "Tour"}, resource.Complex)
+	})
+
+	t.Run("get value", func(t *testing.T) {
+		p, err := NewPath("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value")
+		require.Nil(t, err)
+		assert.Equal(t, "26118915-6090-4610-87a4-49d0aa9d5a2b", <-data.Get(p, schema))
+		assert.Equal(t, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value", p.CollectValue())
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		filter, err := NewFilter("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq \"701984\"")
+		require.Nil(t, err)
+		assert.True(t, newPredicate(filter, schema).evaluate(data))
+
+		filter, err = NewFilter("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.displayName sw \"Jane\"")
+		require.Nil(t, err)
+		assert.False(t, newPredicate(filter, schema).evaluate(data))
+	})
+}
+
+func TestSchema_CustomUrn(t *testing.T) {
+	const deviceUrn = "urn:acme:schemas:1.0:Device"
+
+	schema := &Schema{
+		Id: deviceUrn,
+		Attributes: []*Attribute{
+			{
+				Name:       "serial",
+				Type:       TypeString,
+				Mutability: ReadWrite,
+				Assist:     &Assist{JSONName: "serial", Path: "serial", FullPath: deviceUrn + ":serial"},
+			},
+			{
+				Name:       "location",
+				Type:       TypeComplex,
+				Mutability: ReadWrite,
+				Assist:     &Assist{JSONName: "location", Path: "location", FullPath: deviceUrn + ":location"},
+				SubAttributes: []*Attribute{
+					{
+						Name:       "room",
+						Type:       TypeString,
+						Mutability: ReadWrite,
+						Assist:     &Assist{JSONName: "room", Path: "location.room", FullPath: deviceUrn + ":location.room"},
+					},
+				},
+			},
+		},
+	}
+
+	resource := &Resource{Complex{"serial": "A-1"}}
+	err := ApplyPatch(Patch{Op: Add, Path: "urn:acme:schemas:1.0:Device:location.room", Value: "4F"}, resource, schema)
+	require.Nil(t, err)
+	assert.Equal(t, Complex{"serial": "A-1", "location": map[string]interface{}{"room": "4F"}}, resource.Complex)
+
+	p, err := NewPath("urn:acme:schemas:1.0:device:SERIAL")
+	require.Nil(t, err)
+	assert.Equal(t, "A-1", <-resource.Get(p, schema))
+	p.CorrectCase(schema, true)
+	assert.Equal(t, "urn:acme:schemas:1.0:Device:serial", p.Value())
+}
@@ -1,7 +1,9 @@
 package scimpatch
 
 import (
-	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 // SCIM resource
@@ -20,6 +22,20 @@ func (r *Resource) GetData() Complex {
 	return r.Complex
 }
 
+// replace the content of the resource with the given complex, keeping the identity of the underlying map
+func (r *Resource) commit(c Complex) {
+	if r.Complex == nil {
+		r.Complex = c
+		return
+	}
+	for k := range r.Complex {
+		delete(r.Complex, k)
+	}
+	for k, v := range c {
+		r.Complex[k] = v
+	}
+}
+
 // SCIM complex data structure, Not thread-safe
 type Complex map[string]interface{}
 
@@ -33,6 +49,9 @@ func (c Complex) Get(p Path, guide AttributeSource) chan interface{} {
 }
 
 func (c Complex) get(p Path, guide AttributeSource, output chan interface{}) {
+	if ext := extensionPath(p, guide); ext != nil {
+		p = ext
+	}
 	attr := guide.GetAttribute(p, false)
 	if attr == nil {
 		return
@@ -64,6 +83,14 @@ func (c Complex) get(p Path, guide AttributeSource, output chan interface{}) {
 	}
 }
 
+// Clone returns a deep copy of the complex, nested complex and multivalued values are copied as well
+func (c Complex) Clone() Complex {
+	if c == nil {
+		return nil
+	}
+	return Complex(deepCopy(map[string]interface{}(c)).(map[string]interface{}))
+}
+
 // Evaluate given predicate
 func (c Complex) Evaluate(filter FilterNode, guide AttributeSource) bool {
 	return newPredicate(filter, guide).evaluate(c)
@@ -74,10 +101,22 @@ func (c Complex) Evaluate(filter FilterNode, guide AttributeSource) bool {
 func (c Complex) Set(p Path, value interface{}, guide AttributeSource) error {
 	attr := guide.GetAttribute(p, true)
 	if attr == nil {
-		return fmt.Errorf("No attribute found: %s", p.CollectValue())
+		return errInvalidPath("No attribute found: %s", p.CollectValue())
 	}
 
-	// TODO validate
+	last := p
+	for last.Next() != nil {
+		last = last.Next()
+	}
+	var err error
+	if attr.MultiValued && last.FilterRoot() != nil {
+		value, err = attr.CoerceElement(value)
+	} else {
+		value, err = attr.Coerce(value)
+	}
+	if err != nil {
+		return err
+	}
 
 	base, last := p.SeparateAtLast()
 	itemsToSet := make(chan interface{})
@@ -103,13 +142,7 @@ func (c Complex) Set(p Path, value interface{}, guide AttributeSource) error {
 func (c Complex) set(p Path, value interface{}, attr *Attribute) {
 	if attr.MultiValued && p.FilterRoot() != nil {
 		if mv, ok := c[attr.Name].([]interface{}); ok {
-			for i, v := range mv {
-				if c0, ok := v.(map[string]interface{}); ok {
-					if Complex(c0).Evaluate(p.FilterRoot(), attr) {
-						MultiValued(mv).Set(i, value)
-					}
-				}
-			}
+			MultiValued(mv).ReplaceByFilter(p.FilterRoot(), attr, value)
 		}
 	} else {
 		c[attr.Name] = value
@@ -135,9 +168,128 @@ func (c MultiValued) Add(value ...interface{}) MultiValued {
 	return MultiValued(append([]interface{}(c), value...))
 }
 
+// Add the values which are not yet present, as judged by Contains. Values repeated within the arguments are added only once.
+func (c MultiValued) AddUnique(guide *Attribute, value ...interface{}) MultiValued {
+	result := c
+	for _, v := range value {
+		if !result.Contains(guide, v) {
+			result = result.Add(v)
+		}
+	}
+	return result
+}
+
+// Remove the element at the index, the receiver is left untouched
 func (c MultiValued) Remove(index int) MultiValued {
-	// TODO
-	return nil
+	if index < 0 || index >= len(c) {
+		return c
+	}
+	result := make([]interface{}, 0, len(c)-1)
+	result = append(result, c[:index]...)
+	result = append(result, c[index+1:]...)
+	return MultiValued(result)
+}
+
+// Remove the elements matching the filter, the receiver is left untouched.
+// Returns the remaining elements and the removed elements.
+func (c MultiValued) RemoveByFilter(root FilterNode, guide AttributeSource) (MultiValued, MultiValued) {
+	remaining, removed := make([]interface{}, 0, len(c)), make([]interface{}, 0)
+	matches := c.FindIndex(root, guide)
+	for i, elem := range c {
+		if len(matches) > 0 && matches[0] == i {
+			removed = append(removed, elem)
+			matches = matches[1:]
+		} else {
+			remaining = append(remaining, elem)
+		}
+	}
+	return MultiValued(remaining), MultiValued(removed)
+}
+
+// Find the indexes of the elements matching the filter, in ascending order
+func (c MultiValued) FindIndex(root FilterNode, guide AttributeSource) []int {
+	indexes := make([]int, 0)
+	for i, elem := range c {
+		if m, ok := elem.(map[string]interface{}); ok {
+			if Complex(m).Evaluate(root, guide) {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes
+}
+
+// Replace the elements matching the filter with the value in place. Returns the indexes of the replaced elements.
+func (c MultiValued) ReplaceByFilter(root FilterNode, guide AttributeSource, value interface{}) []int {
+	indexes := c.FindIndex(root, guide)
+	for _, i := range indexes {
+		c.Set(i, deepCopy(value))
+	}
+	return indexes
+}
+
+// Index of the first element equal to the value as judged by the attribute, -1 if there is none.
+// Complex elements are compared by their 'value' sub attribute when they have one, otherwise by all sub attributes,
+// and strings are compared honoring caseExact.
+func (c MultiValued) IndexOf(guide *Attribute, value interface{}) int {
+	elemAttr := guide.elementAttribute()
+	for i, elem := range c {
+		if elemAttr.valueEquals(elem, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Whether an element equal to the value is present, see IndexOf
+func (c MultiValued) Contains(guide *Attribute, value interface{}) bool {
+	return c.IndexOf(guide, value) >= 0
+}
+
+// Index of the first element flagged as primary, -1 if there is none
+func (c MultiValued) Primary() int {
+	for i, elem := range c {
+		if isPrimary(elem) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Flag the element at the index as primary in place, clearing the flag of all the other elements
+func (c MultiValued) SetPrimary(index int) {
+	c.ClearPrimary()
+	if m, ok := c[index].(map[string]interface{}); ok {
+		m[primaryKey] = true
+	}
+}
+
+// Clear the primary flag of all elements in place
+func (c MultiValued) ClearPrimary() {
+	for _, elem := range c {
+		if isPrimary(elem) {
+			elem.(map[string]interface{})[primaryKey] = false
+		}
+	}
+}
+
+// Clone returns a deep copy of the multivalued, nested complex and multivalued values are copied as well
+func (c MultiValued) Clone() MultiValued {
+	if c == nil {
+		return nil
+	}
+	return MultiValued(deepCopy([]interface{}(c)).([]interface{}))
+}
+
+// name of the sub attribute flagging the preferred element of a multivalued, see RFC 7643 section 2.4
+const primaryKey = "primary"
+
+func isPrimary(elem interface{}) bool {
+	if m, ok := elem.(map[string]interface{}); ok {
+		primary, ok := m[primaryKey].(bool)
+		return ok && primary
+	}
+	return false
 }
 
 func (c MultiValued) Filter(root FilterNode, guide AttributeSource) chan interface{} {
@@ -154,3 +306,137 @@ func (c MultiValued) Filter(root FilterNode, guide AttributeSource) chan interfa
 	}()
 	return output
 }
+
+// copy the maps and slices in the value tree, leaving the scalar values as they are
+func deepCopy(v interface{}) interface{} {
+	switch v0 := v.(type) {
+	case Complex:
+		return Complex(deepCopy(map[string]interface{}(v0)).(map[string]interface{}))
+	case map[string]interface{}:
+		if v0 == nil {
+			return v0
+		}
+		m := make(map[string]interface{}, len(v0))
+		for k, elem := range v0 {
+			m[k] = deepCopy(elem)
+		}
+		return m
+	case MultiValued:
+		return MultiValued(deepCopy([]interface{}(v0)).([]interface{}))
+	case []interface{}:
+		if v0 == nil {
+			return v0
+		}
+		arr := make([]interface{}, len(v0))
+		for i, elem := range v0 {
+			arr[i] = deepCopy(elem)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+// compare two values of the single-valued attribute
+func (a *Attribute) valueEquals(x, y interface{}) bool {
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+
+	if a.MultiValued {
+		ax, okx := x.([]interface{})
+		ay, oky := y.([]interface{})
+		if !okx || !oky || len(ax) != len(ay) {
+			return reflect.DeepEqual(x, y)
+		}
+		elemAttr := a.elementAttribute()
+		for i := range ax {
+			if !elemAttr.valueEquals(ax[i], ay[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch a.Type {
+	case TypeComplex:
+		mx, okx := x.(map[string]interface{})
+		my, oky := y.(map[string]interface{})
+		if !okx || !oky {
+			return reflect.DeepEqual(x, y)
+		}
+
+		if valueAttr := a.SubAttribute("value"); valueAttr != nil && (mx["value"] != nil || my["value"] != nil) {
+			return valueAttr.valueEquals(mx["value"], my["value"])
+		}
+
+		for _, subAttr := range a.SubAttributes {
+			if !subAttr.valueEquals(lookup(mx, subAttr.Name), lookup(my, subAttr.Name)) {
+				return false
+			}
+		}
+		return true
+
+	case TypeString, TypeReference, TypeBinary, TypeDateTime:
+		sx, okx := x.(string)
+		sy, oky := y.(string)
+		if !okx || !oky {
+			return reflect.DeepEqual(x, y)
+		}
+		if a.CaseExact {
+			return sx == sy
+		}
+		return strings.ToLower(sx) == strings.ToLower(sy)
+
+	case TypeInteger, TypeDecimal:
+		fx, okx := toFloat(x)
+		fy, oky := toFloat(y)
+		if !okx || !oky {
+			return reflect.DeepEqual(x, y)
+		}
+		return fx == fy
+
+	default:
+		return reflect.DeepEqual(x, y)
+	}
+}
+
+// get the value of the key from the map, ignoring the case
+func lookup(m map[string]interface{}, key string) interface{} {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.ToLower(k) == strings.ToLower(key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// keys of the map in alphabetical order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
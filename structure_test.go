@@ -245,3 +245,123 @@ func TestComplex_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestComplex_Clone(t *testing.T) {
+	c := Complex{
+		"userName": "david",
+		"name":     map[string]interface{}{"familyName": "Qiu"},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "a@foo.com", "type": "work"},
+		},
+	}
+
+	c0 := c.Clone()
+	assert.True(t, reflect.DeepEqual(c, c0))
+
+	c0["userName"] = "foo"
+	c0["name"].(map[string]interface{})["familyName"] = "Q"
+	c0["emails"].([]interface{})[0].(map[string]interface{})["type"] = "home"
+	c0["emails"] = append(c0["emails"].([]interface{}), map[string]interface{}{"value": "b@foo.com"})
+
+	assert.Equal(t, "david", c["userName"])
+	assert.Equal(t, "Qiu", c["name"].(map[string]interface{})["familyName"])
+	assert.Equal(t, 1, len(c["emails"].([]interface{})))
+	assert.Equal(t, "work", c["emails"].([]interface{})[0].(map[string]interface{})["type"])
+}
+
+func TestMultiValued(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	assert.Nil(t, err)
+
+	emailsPath, err := NewPath("emails")
+	require.Nil(t, err)
+	emailsAttr := schema.GetAttribute(emailsPath, true)
+	require.NotNil(t, emailsAttr)
+
+	newEmails := func() MultiValued {
+		return MultiValued{
+			map[string]interface{}{"value": "a@foo.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "b@foo.com", "type": "home"},
+			map[string]interface{}{"value": "c@foo.com", "type": "work"},
+		}
+	}
+	workFilter, err := NewFilter("type eq \"work\"")
+	require.Nil(t, err)
+
+	t.Run("remove", func(t *testing.T) {
+		mv := newEmails()
+		result := mv.Remove(1)
+		assert.Equal(t, 2, result.Len())
+		assert.Equal(t, "a@foo.com", result.Get(0).(map[string]interface{})["value"])
+		assert.Equal(t, "c@foo.com", result.Get(1).(map[string]interface{})["value"])
+		assert.Equal(t, 3, mv.Len())
+		assert.Equal(t, "b@foo.com", mv.Get(1).(map[string]interface{})["value"])
+		assert.Equal(t, 3, mv.Remove(3).Len())
+	})
+
+	t.Run("find index", func(t *testing.T) {
+		assert.Equal(t, []int{0, 2}, newEmails().FindIndex(workFilter, emailsAttr))
+	})
+
+	t.Run("remove by filter", func(t *testing.T) {
+		remaining, removed := newEmails().RemoveByFilter(workFilter, emailsAttr)
+		require.Equal(t, 1, remaining.Len())
+		assert.Equal(t, "b@foo.com", remaining.Get(0).(map[string]interface{})["value"])
+		require.Equal(t, 2, removed.Len())
+		assert.Equal(t, "a@foo.com", removed.Get(0).(map[string]interface{})["value"])
+		assert.Equal(t, "c@foo.com", removed.Get(1).(map[string]interface{})["value"])
+	})
+
+	t.Run("replace by filter", func(t *testing.T) {
+		mv := newEmails()
+		indexes := mv.ReplaceByFilter(workFilter, emailsAttr, map[string]interface{}{"value": "d@foo.com"})
+		assert.Equal(t, []int{0, 2}, indexes)
+		assert.Equal(t, map[string]interface{}{"value": "d@foo.com"}, mv.Get(0))
+		assert.Equal(t, "b@foo.com", mv.Get(1).(map[string]interface{})["value"])
+		assert.Equal(t, map[string]interface{}{"value": "d@foo.com"}, mv.Get(2))
+	})
+
+	t.Run("index of", func(t *testing.T) {
+		mv := newEmails()
+		assert.Equal(t, 1, mv.IndexOf(emailsAttr, map[string]interface{}{"value": "B@FOO.COM"}))
+		assert.Equal(t, -1, mv.IndexOf(emailsAttr, map[string]interface{}{"value": "d@foo.com"}))
+		assert.True(t, mv.Contains(emailsAttr, map[string]interface{}{"value": "c@foo.com", "type": "home"}))
+	})
+
+	t.Run("add unique", func(t *testing.T) {
+		result := newEmails().AddUnique(emailsAttr,
+			map[string]interface{}{"value": "a@foo.com"},
+			map[string]interface{}{"value": "d@foo.com"},
+			map[string]interface{}{"value": "D@foo.com"},
+		)
+		require.Equal(t, 4, result.Len())
+		assert.Equal(t, "d@foo.com", result.Get(3).(map[string]interface{})["value"])
+	})
+
+	t.Run("add unique without value sub attribute", func(t *testing.T) {
+		addressesPath, err := NewPath("addresses")
+		require.Nil(t, err)
+		addressesAttr := schema.GetAttribute(addressesPath, true)
+
+		mv := MultiValued{map[string]interface{}{"locality": "Tokyo", "type": "work"}}
+		result := mv.AddUnique(addressesAttr,
+			map[string]interface{}{"locality": "tokyo", "type": "work"},
+			map[string]interface{}{"locality": "Tokyo", "type": "home"},
+		)
+		assert.Equal(t, 2, result.Len())
+	})
+
+	t.Run("primary", func(t *testing.T) {
+		mv := newEmails()
+		assert.Equal(t, 0, mv.Primary())
+
+		mv.SetPrimary(2)
+		assert.Equal(t, 2, mv.Primary())
+		assert.Equal(t, false, mv.Get(0).(map[string]interface{})["primary"])
+		assert.Nil(t, mv.Get(1).(map[string]interface{})["primary"])
+
+		mv.ClearPrimary()
+		assert.Equal(t, -1, mv.Primary())
+	})
+}
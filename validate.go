@@ -0,0 +1,190 @@
+package scimpatch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate the modification, reporting every violation found at once as Errors, each located in the request,
+// such as Operations[2].path. With StrictCompliance, deviations from RFC 7644 tolerated by the dialects are reported too.
+func (m Modification) Validate(opts ...PatchOption) error {
+	return m.violations(nil, newPatchOptions(opts)).orNil()
+}
+
+// Validate the modification as Validate does, and also check every operation against the schema, so that the modification
+// is known to be applicable before any resource is touched: paths and the attributes in their filters are resolved, filter
+// values are checked against the types of the attributes they are compared with, and values against the targeted attributes.
+func (m Modification) ValidateAgainst(schema *Schema, opts ...PatchOption) error {
+	return m.violations(schema, newPatchOptions(opts)).orNil()
+}
+
+// every violation in the modification, see RFC 7644 section 3.5.2. Paths are resolved only when the schema is given.
+func (m Modification) violations(schema *Schema, opts *patchOptions) Errors {
+	errs := make(Errors, 0)
+	if len(m.Schemas) != 1 || m.Schemas[0] != PatchOpUrn {
+		errs = append(errs, errInvalidSyntax("Invalid parameter: schemas must be exactly [%s]", PatchOpUrn).at("schemas"))
+	}
+	if len(m.Ops) == 0 {
+		errs = append(errs, errInvalidSyntax("Invalid parameter: no ops").at("Operations"))
+	}
+	for i, patch := range m.Ops {
+		for _, err := range patchViolations(patch, schema, opts) {
+			errs = append(errs, err.at(fmt.Sprintf("Operations[%d]", i)))
+		}
+	}
+	return errs
+}
+
+// every violation in the patch operation, located in the operation
+func patchViolations(patch Patch, schema *Schema, opts *patchOptions) Errors {
+	errs := make(Errors, 0)
+	patch, err := opts.dialect.PreparePatch(patch)
+	if err != nil {
+		return append(errs, AsError(err))
+	}
+
+	op := strings.ToLower(patch.Op)
+	switch op {
+	case Add, Replace:
+		if patch.Value == nil {
+			errs = append(errs, errInvalidValue("Invalid parameter: value is not present for %s", op).at("value"))
+		}
+		if len(patch.Path) == 0 {
+			if _, ok := patch.Value.(map[string]interface{}); !ok && patch.Value != nil {
+				errs = append(errs, errInvalidValue("Invalid parameter: value must be an object when path is not present").at("value"))
+			}
+		}
+	case Remove:
+		if len(patch.Path) == 0 {
+			errs = append(errs, errNoTarget("Invalid parameter: path is not present for %s", op).at("path"))
+		}
+		if patch.Value != nil && opts.strict {
+			errs = append(errs, errInvalidSyntax("Invalid parameter: value must not be present for %s", op).at("value"))
+		}
+	default:
+		errs = append(errs, errInvalidSyntax("Invalid operation: must be one of [add|remove|replace], got %s", patch.Op).at("op"))
+	}
+
+	if len(patch.Path) > 0 {
+		if p, err := NewPath(patch.Path); err != nil {
+			errs = append(errs, AsError(err).at("path"))
+		} else if schema != nil {
+			attr, pathErrs := pathViolations(p, schema)
+			errs = append(errs, pathErrs...)
+			if attr != nil && (op == Add || op == Replace) {
+				errs = append(errs, valueViolations(attr, patch.Value, acceptsElement(op, p), opts)...)
+			}
+		}
+	} else if value, ok := patch.Value.(map[string]interface{}); ok && schema != nil && (op == Add || op == Replace) {
+		for _, k := range sortedKeys(value) {
+			_, attr := keyPath(k, schema)
+			if attr == nil {
+				errs = append(errs, errInvalidPath("No attribute found for path: %s", k).at("value"))
+				continue
+			}
+			errs = append(errs, valueViolations(attr, value[k], op == Add, opts)...)
+		}
+	}
+	return errs
+}
+
+// resolve every segment of the path against the schema, and check the filters on the way.
+// The attribute the path resolves to is returned, or nil if it does not resolve.
+func pathViolations(p Path, schema *Schema) (*Attribute, Errors) {
+	errs := make(Errors, 0)
+	p.CorrectCase(schema, true)
+
+	var (
+		guide AttributeSource = schema
+		attr  *Attribute
+	)
+	for seg := p; seg != nil; seg = seg.Next() {
+		if attr = guide.GetAttribute(seg, false); attr == nil {
+			return nil, append(errs, errInvalidPath("No attribute found for path: %s", p.CollectValue()).at("path"))
+		}
+		if seg.FilterRoot() != nil {
+			if !attr.MultiValued {
+				errs = append(errs, errInvalidFilter("Invalid filter: %s is not multi-valued", attr.Assist.FullPath).at("path"))
+			}
+			for _, err := range filterViolations(seg.FilterRoot(), attr) {
+				errs = append(errs, err.at("path"))
+			}
+		}
+		guide = attr
+	}
+	return attr, errs
+}
+
+// resolve the path operands of the filter against the attribute, and check the constants against their types,
+// see RFC 7644 section 3.4.2.2
+func filterViolations(node FilterNode, guide *Attribute) Errors {
+	errs := make(Errors, 0)
+	switch node.Type() {
+	case LogicalOperator:
+		errs = append(errs, filterViolations(node.Left(), guide)...)
+		if node.Data() != Not {
+			errs = append(errs, filterViolations(node.Right(), guide)...)
+		}
+	case RelationalOperator:
+		if node.Left().Type() != PathOperand {
+			return append(errs, errInvalidFilter("Invalid filter: %s must follow an attribute", node.Data()))
+		}
+		key := node.Left().Data().(Path)
+		attr := guide.GetAttribute(key, true)
+		if attr == nil {
+			return append(errs, errInvalidFilter("Invalid filter: no attribute found for %s", key.CollectValue()))
+		}
+		if node.Data() == Pr {
+			return errs
+		}
+		if node.Right().Type() != ConstantOperand {
+			return append(errs, errInvalidFilter("Invalid filter: %s %s must be followed by a value", key.CollectValue(), node.Data()))
+		}
+		if !filterComparable(attr, node.Data().(string), node.Right().Data()) {
+			errs = append(errs, errInvalidFilter("Invalid filter: %s %s %v does not compare %s",
+				key.CollectValue(), node.Data(), node.Right().Data(), attr.TypeExpectation()))
+		}
+	default:
+		errs = append(errs, errInvalidFilter("Invalid filter: unexpected %v", node.Data()))
+	}
+	return errs
+}
+
+// whether the attribute can be compared with the constant by the operator
+func filterComparable(attr *Attribute, operator string, constant interface{}) bool {
+	switch attr.Type {
+	case TypeString, TypeReference, TypeDateTime:
+		_, ok := constant.(string)
+		return ok
+	case TypeBinary:
+		_, ok := constant.(string)
+		return ok && (operator == Eq || operator == Ne)
+	case TypeBoolean:
+		_, ok := constant.(bool)
+		return ok && (operator == Eq || operator == Ne)
+	case TypeInteger:
+		_, ok := constant.(int64)
+		return ok && operator != Sw && operator != Ew && operator != Co
+	case TypeDecimal:
+		switch constant.(type) {
+		case int64, float64:
+			return operator != Sw && operator != Ew && operator != Co
+		}
+	}
+	return false
+}
+
+// check the value against the type of the attribute, after the dialect has fixed it
+func valueViolations(attr *Attribute, value interface{}, element bool, opts *patchOptions) Errors {
+	if value == nil {
+		return nil
+	}
+	coerce := attr.Coerce
+	if element {
+		coerce = attr.CoerceElement
+	}
+	if _, err := coerce(opts.dialect.CoerceValue(attr, value)); err != nil {
+		return Errors{AsError(err).at("value")}
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package scimpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestModificationValidate(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		name   string
+		mod    Modification
+		schema *Schema
+		errors []string
+	}{
+		{
+			"valid",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: "Add", Path: "Emails", Value: map[string]interface{}{"value": "foo@bar.com"}},
+				{Op: Remove, Path: "emails", Value: []interface{}{map[string]interface{}{"value": "foo@bar.com"}}},
+			}},
+			schema,
+			nil,
+		},
+		{
+			"empty schemas",
+			Modification{Ops: []Patch{{Op: Remove, Path: "nickName"}}},
+			nil,
+			[]string{"schemas: invalidSyntax"},
+		},
+		{
+			"wrong schema",
+			Modification{Schemas: []string{UserUrn}, Ops: []Patch{{Op: Remove, Path: "nickName"}}},
+			nil,
+			[]string{"schemas: invalidSyntax"},
+		},
+		{
+			"no ops",
+			Modification{Schemas: []string{PatchOpUrn}},
+			nil,
+			[]string{"Operations: invalidSyntax"},
+		},
+		{
+			"every operation",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Replace, Path: "userName", Value: "foo"},
+				{Op: Add},
+				{Op: Replace, Path: "emails[(type eq \"work\"]", Value: "foo"},
+				{Op: "move", Path: "userName"},
+				{Op: Remove},
+			}},
+			nil,
+			[]string{
+				"Operations[1].value: invalidValue",
+				"Operations[2].path: invalidFilter",
+				"Operations[3].op: invalidSyntax",
+				"Operations[4].path: noTarget",
+			},
+		},
+		{
+			"unresolved paths",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Replace, Path: "USERNAME", Value: "foo"},
+				{Op: Replace, Path: "unknown", Value: "foo"},
+				{Op: Remove, Path: "name.unknown"},
+			}},
+			schema,
+			[]string{
+				"Operations[1].path: invalidPath",
+				"Operations[2].path: invalidPath",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var err error
+			if test.schema == nil {
+				err = test.mod.Validate()
+			} else {
+				err = test.mod.ValidateAgainst(test.schema)
+			}
+			if len(test.errors) == 0 {
+				assert.Nil(t, err)
+				return
+			}
+
+			require.NotNil(t, err)
+			errs, ok := err.(Errors)
+			require.True(t, ok)
+			located := make([]string, 0)
+			for _, e := range errs {
+				located = append(located, e.Location+": "+e.ScimType)
+			}
+			assert.Equal(t, test.errors, located)
+		})
+	}
+
+	t.Run("located error", func(t *testing.T) {
+		err := Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+			{Op: Remove, Path: "nickName"},
+			{Op: Replace, Path: "unknown", Value: "foo"},
+		}}.ValidateAgainst(schema)
+		require.NotNil(t, err)
+		assert.Equal(t, "Operations[1].path: No attribute found for path: unknown", err.Error())
+	})
+}
+
+func TestModificationValidateAgainst(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &schema)
+	require.Nil(t, err)
+	// the schema of RFC 7643 has no integer attributes, so one is added to cover filters on them
+	schema.Attributes = append(schema.Attributes, &Attribute{
+		Name:        "devices",
+		Type:        TypeComplex,
+		MultiValued: true,
+		SubAttributes: []*Attribute{
+			{Name: "id", Type: TypeString, Assist: &Assist{FullPath: UserUrn + ":devices.id"}},
+			{Name: "logins", Type: TypeInteger, Assist: &Assist{FullPath: UserUrn + ":devices.logins"}},
+		},
+		Assist: &Assist{FullPath: UserUrn + ":devices"},
+	})
+
+	for _, test := range []struct {
+		name   string
+		patch  Patch
+		errors []string
+	}{
+		{
+			"filter resolved",
+			Patch{Op: Replace, Path: "emails[TYPE eq \"work\" and not (primary eq false)].value", Value: "foo@bar.com"},
+			nil,
+		},
+		{
+			"typo in filter",
+			Patch{Op: Replace, Path: "emails[typ eq \"work\"].value", Value: "foo@bar.com"},
+			[]string{"path: invalidFilter"},
+		},
+		{
+			"every filter operand",
+			Patch{Op: Remove, Path: "emails[typ eq \"work\" or prim pr or value pr]"},
+			[]string{"path: invalidFilter", "path: invalidFilter"},
+		},
+		{
+			"boolean compared with string",
+			Patch{Op: Remove, Path: "emails[primary eq \"true\"]"},
+			[]string{"path: invalidFilter"},
+		},
+		{
+			"boolean ordered",
+			Patch{Op: Remove, Path: "emails[primary gt false]"},
+			[]string{"path: invalidFilter"},
+		},
+		{
+			"string compared with number",
+			Patch{Op: Remove, Path: "emails[value sw 1]"},
+			[]string{"path: invalidFilter"},
+		},
+		{
+			"binary compared by substring",
+			Patch{Op: Remove, Path: "x509Certificates[value co \"MIIDQz\"]"},
+			[]string{"path: invalidFilter"},
+		},
+		{
+			"filter on single-valued attribute",
+			Patch{Op: Remove, Path: "name[givenName eq \"David\"]"},
+			[]string{"path: invalidFilter"},
+		},
+		{
+			"unknown sub attribute",
+			Patch{Op: Replace, Path: "emails[type eq \"work\"].unknown", Value: "foo"},
+			[]string{"path: invalidPath"},
+		},
+		{
+			"value of wrong type",
+			Patch{Op: Replace, Path: "active", Value: 1},
+			[]string{"value: invalidValue"},
+		},
+		{
+			"value fixed by dialect",
+			Patch{Op: Replace, Path: "active", Value: []interface{}{map[string]interface{}{"value": "True"}}},
+			nil,
+		},
+		{
+			"value not fixed by dialect",
+			Patch{Op: Replace, Path: "userName", Value: 1},
+			[]string{"value: invalidValue"},
+		},
+		{
+			"filter on integer",
+			Patch{Op: Replace, Path: "devices[logins eq 1 or logins gt 0].id", Value: "foo"},
+			nil,
+		},
+		{
+			"filter on integer with boolean",
+			Patch{Op: Replace, Path: "devices[logins eq true].id", Value: "foo"},
+			[]string{"path: invalidFilter"},
+		},
+		{
+			"element of multivalued",
+			Patch{Op: Add, Path: "emails", Value: map[string]interface{}{"value": "foo@bar.com", "primary": "yes"}},
+			[]string{"value: invalidValue"},
+		},
+		{
+			"pathless add",
+			Patch{Op: Add, Value: map[string]interface{}{"nickName": "Q", "active": "yes"}},
+			[]string{"value: invalidValue"},
+		},
+		{
+			"pathless replace",
+			Patch{Op: Replace, Value: map[string]interface{}{"ACTIVE": false, UserUrn + ":nickName": "Q"}},
+			nil,
+		},
+		{
+			"pathless replace with unknown attributes",
+			Patch{Op: Replace, Value: map[string]interface{}{"active": false, "unknown": "foo", UserUrn + ":unknown": "foo"}},
+			[]string{"value: invalidPath", "value: invalidPath"},
+		},
+		{
+			"pathless replace with path keys",
+			Patch{Op: Replace, Value: map[string]interface{}{"NAME.givenName": "Q", "emails[type eq \"work\"].value": "foo", "name.unknown": "foo"}},
+			[]string{"value: invalidPath"},
+		},
+		{
+			"pathless replace with non-object value",
+			Patch{Op: Replace, Value: "foo"},
+			[]string{"value: invalidValue"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{test.patch}}.ValidateAgainst(schema)
+			if len(test.errors) == 0 {
+				assert.Nil(t, err)
+				return
+			}
+
+			require.NotNil(t, err)
+			located := make([]string, 0)
+			for _, e := range err.(Errors) {
+				located = append(located, e.Location[len("Operations[0]."):]+": "+e.ScimType)
+			}
+			assert.Equal(t, test.errors, located)
+		})
+	}
+}
+
+func TestModificationValidateStrict(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		mod       Modification
+		scimTypes []string
+	}{
+		{
+			"compliant",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Add, Value: map[string]interface{}{"nickName": "Q"}},
+				{Op: Replace, Path: "userName", Value: "foo"},
+				{Op: Remove, Path: "emails[type eq \"work\"]"},
+			}},
+			nil,
+		},
+		{
+			"wrong schemas",
+			Modification{Schemas: []string{PatchOpUrn, UserUrn}, Ops: []Patch{{Op: Remove, Path: "nickName"}}},
+			[]string{ScimTypeInvalidSyntax},
+		},
+		{
+			"empty schemas and no ops",
+			Modification{},
+			[]string{ScimTypeInvalidSyntax, ScimTypeInvalidSyntax},
+		},
+		{
+			"every violation",
+			Modification{Schemas: []string{PatchOpUrn}, Ops: []Patch{
+				{Op: Add, Value: "foo"},
+				{Op: Remove, Path: "members", Value: []interface{}{map[string]interface{}{"value": "foo"}}},
+				{Op: Replace, Path: "emails[type eq \"work\""},
+				{Op: "move", Path: "userName"},
+				{Op: Replace, Path: "userName"},
+			}},
+			[]string{ScimTypeInvalidValue, ScimTypeInvalidSyntax, ScimTypeInvalidValue, ScimTypeInvalidPath, ScimTypeInvalidSyntax, ScimTypeInvalidValue},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.mod.Validate(StrictCompliance())
+			if len(test.scimTypes) == 0 {
+				assert.Nil(t, err)
+				return
+			}
+
+			require.NotNil(t, err)
+			errs, ok := err.(Errors)
+			require.True(t, ok)
+			scimTypes := make([]string, 0)
+			for _, e := range errs {
+				scimTypes = append(scimTypes, e.ScimType)
+			}
+			assert.Equal(t, test.scimTypes, scimTypes)
+		})
+	}
+}
+
+func TestApplyPatchStrict(t *testing.T) {
+	userSchema := &Schema{}
+	err := json.Unmarshal([]byte(UserSchemaJson), &userSchema)
+	require.Nil(t, err)
+
+	groupSchema := &Schema{}
+	err = json.Unmarshal([]byte(GroupSchemaJson), &groupSchema)
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		name      string
+		schema    *Schema
+		patch     Patch
+		assertion func(r *Resource, err error)
+	}{
+		{
+			"compliant",
+			userSchema,
+			Patch{Op: Replace, Path: "active", Value: false},
+			func(r *Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, false, r.GetData()["active"])
+			},
+		},
+		{
+			"boolean as string",
+			userSchema,
+			Patch{Op: Replace, Path: "active", Value: "False"},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, AsError(err).ScimType)
+				assert.Equal(t, true, r.GetData()["active"])
+			},
+		},
+		{
+			"remove with value",
+			groupSchema,
+			Patch{Op: Remove, Path: "members", Value: []interface{}{map[string]interface{}{"value": "first_member_id"}}},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidSyntax, AsError(err).ScimType)
+				assert.Equal(t, 2, len(r.GetData()["members"].([]interface{})))
+			},
+		},
+		{
+			"pathless add with non-object value",
+			userSchema,
+			Patch{Op: Add, Value: "foo"},
+			func(r *Resource, err error) {
+				require.NotNil(t, err)
+				assert.Equal(t, ScimTypeInvalidValue, AsError(err).ScimType)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource := &Resource{Complex{
+				"userName": "david",
+				"active":   true,
+				"members": []interface{}{
+					map[string]interface{}{"value": "first_member_id"},
+					map[string]interface{}{"value": "second_member_id"},
+				},
+			}}
+			err := ApplyPatch(test.patch, resource, test.schema, StrictCompliance())
+			test.assertion(resource, err)
+		})
+	}
+
+	t.Run("modification", func(t *testing.T) {
+		resource := &Resource{Complex{"userName": "david"}}
+		err := ApplyModification(Modification{Schemas: []string{PatchOpUrn, UserUrn}, Ops: []Patch{
+			{Op: Replace, Path: "userName", Value: "foo"},
+			{Op: Remove, Path: "nickName", Value: "Q"},
+		}}, resource, userSchema, StrictCompliance())
+		require.NotNil(t, err)
+		assert.Equal(t, 2, len(err.(Errors)))
+		assert.Equal(t, "david", resource.GetData()["userName"])
+
+		status, body := RenderError(err)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.JSONEq(t, `{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"],
+			"scimType": "invalidSyntax",
+			"detail": "schemas: Invalid parameter: schemas must be exactly [urn:ietf:params:scim:api:messages:2.0:PatchOp]; Operations[1].value: Invalid parameter: value must not be present for remove",
+			"status": "400"
+		}`, string(body))
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		resource := &Resource{Complex{"userName": "david"}}
+		mod := Modification{Schemas: []string{"x"}, Ops: []Patch{{Op: Replace, Path: "userName", Value: "foo"}}}
+		r, _, err := DryRunModification(mod, resource, userSchema, StrictCompliance())
+		require.NotNil(t, err)
+		assert.Equal(t, ScimTypeInvalidSyntax, AsError(err).ScimType)
+		assert.Nil(t, r)
+
+		_, _, err = DryRunModification(mod, resource, userSchema)
+		assert.Nil(t, err)
+	})
+}